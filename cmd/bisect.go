@@ -0,0 +1,138 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/gitkustomizediff"
+	"github.com/spf13/cobra"
+)
+
+type bisectFlags struct {
+	dir                     string
+	good                    string
+	bad                     string
+	remote                  string
+	kind                    string
+	namespace               string
+	name                    string
+	field                   string
+	value                   string
+	buildFails              bool
+	kustomizePath           string
+	kustomizeLoadRestrictor string
+	cache                   bool
+	cacheDir                string
+	gitPath                 string
+	debug                   bool
+	fetch                   bool
+	repoURL                 string
+	repoProvider            string
+}
+
+var bisectCmd = &cobra.Command{
+	Use:   "bisect kustomization_dir",
+	Short: "Find the commit which introduced a rendered change",
+	Long:  `Find the first commit between good and bad where the predicate on the rendered output flips. Only the first parents are followed, so a change made in a merged branch is reported as the merge commit`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := gitkustomizediff.BisectOpts{
+			Good:   bisectOpts.good,
+			Bad:    bisectOpts.bad,
+			Remote: bisectOpts.remote,
+			Predicate: gitkustomizediff.BisectPredicate{
+				BuildFails: bisectOpts.buildFails,
+				Selector: gitkustomizediff.ResourceSelector{
+					Kind:      bisectOpts.kind,
+					Namespace: bisectOpts.namespace,
+					Name:      bisectOpts.name,
+				},
+				FieldPath: bisectOpts.field,
+			},
+			KustomizePath:           bisectOpts.kustomizePath,
+			KustomizeLoadRestrictor: bisectOpts.kustomizeLoadRestrictor,
+			GitPath:                 bisectOpts.gitPath,
+			Debug:                   bisectOpts.debug,
+			Fetch:                   bisectOpts.fetch,
+			RepoURL:                 bisectOpts.repoURL,
+			RepoProvider:            gitkustomizediff.RepoProvider(bisectOpts.repoProvider),
+		}
+		if cmd.Flags().Changed("value") {
+			opts.Predicate.Value = &bisectOpts.value
+		}
+
+		cacheDir, err := resolveCacheDir(bisectOpts.cache, bisectOpts.cacheDir)
+		if err != nil {
+			return err
+		}
+		opts.CacheDir = cacheDir
+
+		res, err := gitkustomizediff.Bisect(bisectOpts.dir, args[0], opts)
+		if err != nil {
+			fmt.Printf("%+v\n", err)
+			os.Exit(1)
+		}
+
+		printBisectResult(args[0], res)
+
+		return nil
+	},
+}
+
+var bisectOpts bisectFlags
+
+func init() {
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.dir, "dir", ".", "directory the kustomization dir is relative to")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.good, "good", "", "commitish where the predicate holds its original state (default to the default branch of the remote)")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.bad, "bad", "", "commitish where the predicate flipped (default to the current branch)")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.remote, "remote", "", "remote to detect the default branch from (default to origin)")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.kind, "kind", "", "kind of the resource to inspect")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.namespace, "namespace", "", "namespace of the resource to inspect")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.name, "name", "", "name of the resource to inspect")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.field, "field", "", "field path to inspect (e.g. spec.template.spec.containers[name=app].image)")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.value, "value", "", "value of the field to look for (default to any change)")
+	bisectCmd.PersistentFlags().BoolVar(&bisectOpts.buildFails, "build-fails", false, "look for the commit where the build starts failing")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.kustomizePath, "kustomize-path", "", "path of a kustomize binary (default to embedded)")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.kustomizeLoadRestrictor, "kustomize-load-restrictor", "", "kustomize load restrictor type (default to kustomizaton provider defaults)")
+	bisectCmd.PersistentFlags().BoolVar(&bisectOpts.cache, "cache", false, "cache build results on disk")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.cacheDir, "cache-dir", "", "directory of the build cache, which enables the cache (default to the user cache dir)")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.gitPath, "git-path", "", "path of a git binary (default to git)")
+	bisectCmd.PersistentFlags().BoolVar(&bisectOpts.debug, "debug", false, "debug mode")
+	bisectCmd.PersistentFlags().BoolVar(&bisectOpts.fetch, "fetch", false, "fetch the remote before resolving the commits (default to offline)")
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.repoURL, "repo-url", "", repoURLUsage)
+	bisectCmd.PersistentFlags().StringVar(&bisectOpts.repoProvider, "repo-provider", "", repoProviderUsage)
+}
+
+func printBisectResult(kDir string, res *gitkustomizediff.BisectResult) {
+	fmt.Printf("# Git Kustomize Diff Bisect\n\n")
+
+	fmt.Printf("%s\n\n", rangeLink(res.Links, res.GoodCommit, res.BadCommit))
+
+	printCommits(res.Links, []namedCommit{{"good", res.Good}, {"bad", res.Bad}})
+
+	fmt.Printf("%s changed from `%s` to `%s` at %s %s\n\n", markdownLink(fmt.Sprintf("`%s`", kDir), res.Links.TreeURL(res.FirstCommit, res.Links.Path(kDir))), res.GoodState, res.FirstState, commitLink(res.Links, res.FirstCommit), res.Subject)
+
+	fmt.Printf("<details><summary>Steps</summary>\n\n")
+	fmt.Println("| commit | state |")
+	fmt.Println("|-|-|")
+	for _, step := range res.Steps {
+		fmt.Printf("| %s | %s |\n", commitLink(res.Links, step.Commit), step.State)
+	}
+	fmt.Printf("\n</details>\n")
+}
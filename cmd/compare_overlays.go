@@ -0,0 +1,126 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/gitkustomizediff"
+	"github.com/spf13/cobra"
+)
+
+type compareOverlaysFlags struct {
+	dir                     string
+	ref                     string
+	kustomizePath           string
+	kustomizeLoadRestrictor string
+	cache                   bool
+	cacheDir                string
+	gitPath                 string
+	debug                   bool
+	ignoreNamespace         bool
+	ignoreNamePrefixes      []string
+	ignoreNameSuffixes      []string
+	repoURL                 string
+	repoProvider            string
+}
+
+var compareOverlaysCmd = &cobra.Command{
+	Use:   "compare-overlays overlay_dir overlay_dir [overlay_dir...]",
+	Short: "Compare kustomize overlays at the same commit",
+	Long:  `Compare kustomize overlays at the same commit`,
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := gitkustomizediff.CompareOpts{
+			Ref:                     compareOverlaysOpts.ref,
+			KustomizePath:           compareOverlaysOpts.kustomizePath,
+			KustomizeLoadRestrictor: compareOverlaysOpts.kustomizeLoadRestrictor,
+			GitPath:                 compareOverlaysOpts.gitPath,
+			Debug:                   compareOverlaysOpts.debug,
+			IgnoreNamespace:         compareOverlaysOpts.ignoreNamespace,
+			IgnoreNamePrefixes:      compareOverlaysOpts.ignoreNamePrefixes,
+			IgnoreNameSuffixes:      compareOverlaysOpts.ignoreNameSuffixes,
+			RepoURL:                 compareOverlaysOpts.repoURL,
+			RepoProvider:            gitkustomizediff.RepoProvider(compareOverlaysOpts.repoProvider),
+		}
+		cacheDir, err := resolveCacheDir(compareOverlaysOpts.cache, compareOverlaysOpts.cacheDir)
+		if err != nil {
+			return err
+		}
+		opts.CacheDir = cacheDir
+
+		res, err := gitkustomizediff.CompareOverlays(compareOverlaysOpts.dir, args, opts)
+		if err != nil {
+			fmt.Printf("%+v\n", err)
+			os.Exit(1)
+		}
+
+		printCompareResult(res)
+
+		return nil
+	},
+}
+
+var compareOverlaysOpts compareOverlaysFlags
+
+func init() {
+	compareOverlaysCmd.PersistentFlags().StringVar(&compareOverlaysOpts.dir, "dir", ".", "directory the overlay dirs are relative to")
+	compareOverlaysCmd.PersistentFlags().StringVar(&compareOverlaysOpts.ref, "ref", "", "commitish to compare at (default to the working tree)")
+	compareOverlaysCmd.PersistentFlags().StringVar(&compareOverlaysOpts.kustomizePath, "kustomize-path", "", "path of a kustomize binary (default to embedded)")
+	compareOverlaysCmd.PersistentFlags().StringVar(&compareOverlaysOpts.kustomizeLoadRestrictor, "kustomize-load-restrictor", "", "kustomize load restrictor type (default to kustomizaton provider defaults)")
+	compareOverlaysCmd.PersistentFlags().BoolVar(&compareOverlaysOpts.cache, "cache", false, "cache build results on disk")
+	compareOverlaysCmd.PersistentFlags().StringVar(&compareOverlaysOpts.cacheDir, "cache-dir", "", "directory of the build cache, which enables the cache (default to the user cache dir)")
+	compareOverlaysCmd.PersistentFlags().StringVar(&compareOverlaysOpts.gitPath, "git-path", "", "path of a git binary (default to git)")
+	compareOverlaysCmd.PersistentFlags().BoolVar(&compareOverlaysOpts.debug, "debug", false, "debug mode")
+	compareOverlaysCmd.PersistentFlags().BoolVar(&compareOverlaysOpts.ignoreNamespace, "ignore-namespace", false, "ignore namespace differences")
+	compareOverlaysCmd.PersistentFlags().StringSliceVar(&compareOverlaysOpts.ignoreNamePrefixes, "ignore-name-prefix", nil, "name prefixes to ignore (e.g. stg-,prod-)")
+	compareOverlaysCmd.PersistentFlags().StringSliceVar(&compareOverlaysOpts.ignoreNameSuffixes, "ignore-name-suffix", nil, "name suffixes to ignore")
+	compareOverlaysCmd.PersistentFlags().StringVar(&compareOverlaysOpts.repoURL, "repo-url", "", repoURLUsage+" (only with --ref)")
+	compareOverlaysCmd.PersistentFlags().StringVar(&compareOverlaysOpts.repoProvider, "repo-provider", "", repoProviderUsage)
+}
+
+func printCompareResult(res *gitkustomizediff.CompareResult) {
+	fmt.Printf("# Git Kustomize Diff\n\n")
+
+	if res.Commit != "" {
+		fmt.Printf("%s\n\n", commitLink(res.Links, res.Commit))
+	}
+
+	found := false
+	for _, comparison := range res.Comparisons {
+		if comparison.Err != nil {
+			fmt.Printf("## %s...%s\n\n", dirLink(res.Links, res.Commit, comparison.Base), dirLink(res.Links, res.Commit, comparison.Target))
+			fmt.Printf("```\n%s\n```\n\n", comparison.Err)
+			found = true
+			continue
+		}
+		if len(comparison.Diffs) == 0 {
+			continue
+		}
+		fmt.Printf("## %s...%s\n\n", dirLink(res.Links, res.Commit, comparison.Base), dirLink(res.Links, res.Commit, comparison.Target))
+		for _, diff := range comparison.Diffs {
+			fmt.Printf("<details><summary>%s (%s)</summary>\n\n", diff.ID, diff.Type)
+			fmt.Printf("```diff\n%s\n```\n", diff.Content)
+			fmt.Printf("\n</details>\n\n")
+		}
+		found = true
+	}
+	if !found {
+		fmt.Println(":tada::tada: No Diff :tada::tada:")
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/gitkustomizediff"
+)
+
+const (
+	repoURLUsage      = "web URL of the repo to link the report to (e.g. https://github.com/owner/repo)"
+	repoProviderUsage = "hosting provider of the repo URL (github, gitlab, bitbucket or gitea, default to inferred from the host)"
+)
+
+func markdownLink(text, url string) string {
+	if url == "" {
+		return text
+	}
+	return fmt.Sprintf("[%s](%s)", text, url)
+}
+
+func commitLink(links *gitkustomizediff.RepoLinks, commit string) string {
+	return markdownLink(commit, links.CommitURL(commit))
+}
+
+func rangeLink(links *gitkustomizediff.RepoLinks, base, target string) string {
+	return markdownLink(fmt.Sprintf("%s...%s", base, target), links.CompareURL(base, target))
+}
+
+func dirLink(links *gitkustomizediff.RepoLinks, commit, dir string) string {
+	return markdownLink(dir, links.TreeURL(commit, links.Path(dir)))
+}
+
+// kustomizationLink links the dir and its kustomization file. The file is
+// omitted if the kustomization doesn't exist at the commit.
+func kustomizationLink(links *gitkustomizediff.RepoLinks, commit, dir, file string) string {
+	text := dirLink(links, commit, dir)
+	if links == nil || file == "" {
+		return text
+	}
+	return fmt.Sprintf("%s (%s)", text, markdownLink(file, links.BlobURL(commit, links.Path(path.Join(dir, file)))))
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/gitkustomizediff"
+	"github.com/spf13/cobra"
+)
+
+type logFlags struct {
+	base                    string
+	target                  string
+	remote                  string
+	includeRegexpString     string
+	excludeRegexpString     string
+	kustomizePath           string
+	kustomizeLoadRestrictor string
+	cache                   bool
+	cacheDir                string
+	skipUnchanged           bool
+	gitPath                 string
+	debug                   bool
+	fetch                   bool
+	firstParent             bool
+	repoURL                 string
+	repoProvider            string
+}
+
+var logCmd = &cobra.Command{
+	Use:   "log target_dir",
+	Short: "Show rendered changes of each commit",
+	Long:  `Show rendered changes of each commit between base and target`,
+	Args:  cobra.RangeArgs(0, 1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := gitkustomizediff.LogOpts{
+			Base:                    logOpts.base,
+			Target:                  logOpts.target,
+			Remote:                  logOpts.remote,
+			Debug:                   logOpts.debug,
+			Fetch:                   logOpts.fetch,
+			KustomizePath:           logOpts.kustomizePath,
+			KustomizeLoadRestrictor: logOpts.kustomizeLoadRestrictor,
+			SkipUnchanged:           logOpts.skipUnchanged,
+			GitPath:                 logOpts.gitPath,
+			FirstParent:             logOpts.firstParent,
+			RepoURL:                 logOpts.repoURL,
+			RepoProvider:            gitkustomizediff.RepoProvider(logOpts.repoProvider),
+		}
+		if logOpts.includeRegexpString != "" {
+			includeRegexp, err := regexp.Compile(logOpts.includeRegexpString)
+			if err != nil {
+				return err
+			}
+			opts.IncludeRegexp = includeRegexp
+		}
+		if logOpts.excludeRegexpString != "" {
+			excludeRegexp, err := regexp.Compile(logOpts.excludeRegexpString)
+			if err != nil {
+				return err
+			}
+			opts.ExcludeRegexp = excludeRegexp
+		}
+
+		cacheDir, err := resolveCacheDir(logOpts.cache, logOpts.cacheDir)
+		if err != nil {
+			return err
+		}
+		opts.CacheDir = cacheDir
+
+		dir := "."
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		res, err := gitkustomizediff.Log(dir, opts)
+		if err != nil {
+			fmt.Printf("%+v\n", err)
+			os.Exit(1)
+		}
+
+		printLogResult(res)
+
+		return nil
+	},
+}
+
+var logOpts logFlags
+
+func init() {
+	logCmd.PersistentFlags().StringVar(&logOpts.base, "base", "", "base commitish (default to the default branch of the remote)")
+	logCmd.PersistentFlags().StringVar(&logOpts.target, "target", "", "target commitish (default to the current branch)")
+	logCmd.PersistentFlags().StringVar(&logOpts.remote, "remote", "", "remote to detect the default branch from (default to origin)")
+	logCmd.PersistentFlags().StringVar(&logOpts.includeRegexpString, "include", "", "include regexp (default to all)")
+	logCmd.PersistentFlags().StringVar(&logOpts.excludeRegexpString, "exclude", "", "exclude regexp (default to none)")
+	logCmd.PersistentFlags().StringVar(&logOpts.kustomizePath, "kustomize-path", "", "path of a kustomize binary (default to embedded)")
+	logCmd.PersistentFlags().StringVar(&logOpts.kustomizeLoadRestrictor, "kustomize-load-restrictor", "", "kustomize load restrictor type (default to kustomizaton provider defaults)")
+	logCmd.PersistentFlags().BoolVar(&logOpts.cache, "cache", false, "cache build results on disk")
+	logCmd.PersistentFlags().StringVar(&logOpts.cacheDir, "cache-dir", "", "directory of the build cache, which enables the cache (default to the user cache dir)")
+	logCmd.PersistentFlags().BoolVar(&logOpts.skipUnchanged, "skip-unchanged", true, "skip building kustomizations whose input files are identical")
+	logCmd.PersistentFlags().StringVar(&logOpts.gitPath, "git-path", "", "path of a git binary (default to git)")
+	logCmd.PersistentFlags().BoolVar(&logOpts.debug, "debug", false, "debug mode")
+	logCmd.PersistentFlags().BoolVar(&logOpts.fetch, "fetch", false, "fetch the remote before resolving the commits (default to offline)")
+	logCmd.PersistentFlags().BoolVar(&logOpts.firstParent, "first-parent", false, "follow only the first parent of merge commits")
+	logCmd.PersistentFlags().StringVar(&logOpts.repoURL, "repo-url", "", repoURLUsage)
+	logCmd.PersistentFlags().StringVar(&logOpts.repoProvider, "repo-provider", "", repoProviderUsage)
+}
+
+func printLogResult(res *gitkustomizediff.LogResult) {
+	fmt.Printf("# Git Kustomize Diff Log\n\n")
+
+	fmt.Printf("%s\n\n", rangeLink(res.Links, res.BaseCommit, res.TargetCommit))
+
+	printCommits(res.Links, []namedCommit{{"base", res.Base}, {"target", res.Target}, {"merge base", res.MergeBase}})
+
+	fmt.Println("| commit | subject | changed kustomizations |")
+	fmt.Println("|-|-|-|")
+	for _, commitDiff := range res.Commits {
+		dirs := commitDiff.DiffMap.ChangedDirs()
+		changed := "-"
+		if len(dirs) > 0 {
+			dirLinks := make([]string, 0, len(dirs))
+			for _, dir := range dirs {
+				dirLinks = append(dirLinks, dirLink(res.Links, logDirCommit(commitDiff, dir), dir))
+			}
+			changed = strings.Join(dirLinks, ", ")
+		}
+		fmt.Printf("| %s | %s | %s |\n", commitLink(res.Links, commitDiff.Commit), strings.ReplaceAll(commitDiff.Subject, "|", "\\|"), changed)
+	}
+	fmt.Println()
+
+	found := false
+	for _, commitDiff := range res.Commits {
+		dirs := commitDiff.DiffMap.ChangedDirs()
+		if len(dirs) == 0 {
+			continue
+		}
+		fmt.Printf("## %s %s\n\n", commitLink(res.Links, commitDiff.Commit), commitDiff.Subject)
+		for _, dir := range dirs {
+			fmt.Printf("### %s\n\n", kustomizationLink(res.Links, logDirCommit(commitDiff, dir), dir, commitDiff.DiffMap.KustomizationFiles[dir]))
+			fmt.Printf("<details><summary>diff</summary>\n\n")
+			fmt.Println(commitDiff.DiffMap.Results[dir].AsMarkdown())
+			fmt.Printf("\n</details>\n\n")
+		}
+		found = true
+	}
+	if !found {
+		fmt.Println(":tada::tada: No Diff :tada::tada:")
+	}
+}
+
+// logDirCommit returns the parent commit for the kustomizations removed by the
+// commit.
+func logDirCommit(commitDiff *gitkustomizediff.CommitDiff, dir string) string {
+	if _, ok := commitDiff.DiffMap.KustomizationFiles[dir]; ok {
+		return commitDiff.Commit
+	}
+	return commitDiff.ParentCommit
+}
@@ -55,4 +55,7 @@ func init() {
 	RootCmd.PersistentFlags().CountVarP(&rootOpts.verbose, "verbose", "v", "verbose mode. (1: info, 2: debug, 3: trace)")
 	RootCmd.AddCommand(versionCmd)
 	RootCmd.AddCommand(runCmd)
+	RootCmd.AddCommand(compareOverlaysCmd)
+	RootCmd.AddCommand(logCmd)
+	RootCmd.AddCommand(bisectCmd)
 }
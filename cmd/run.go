@@ -21,21 +21,57 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/dtaniwaki/git-kustomize-diff/pkg/gitkustomizediff"
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 type runFlags struct {
 	base                    string
 	target                  string
+	remote                  string
 	includeRegexpString     string
 	excludeRegexpString     string
 	kustomizePath           string
 	kustomizeLoadRestrictor string
+	cache                   bool
+	cacheDir                string
+	skipUnchanged           bool
 	gitPath                 string
 	debug                   bool
+	fetch                   bool
 	allowDirty              bool
+	staged                  bool
+	strategy                string
+	noCheckout              bool
+	gitDir                  string
+	origins                 bool
+	repoURL                 string
+	repoProvider            string
+	analyzers               []string
+	failOn                  string
+	images                  bool
+	imagePaths              []string
+	capacity                bool
+	podSecurityStandards    bool
+	policies                []string
+	kubeVersion             string
+	crdSchemaDirs           []string
+	schemaFiles             []string
+}
+
+// analyzerFlags are the flags used only by the analyzers.
+var analyzerFlags = []struct {
+	name      string
+	analyzers []string
+}{
+	{"pod-security-standards", []string{"podsecurity"}},
+	{"kube-version", []string{"deprecation", "schema"}},
+	{"crd-schema-dir", []string{"schema"}},
+	{"schema-file", []string{"schema"}},
 }
 
 var runCmd = &cobra.Command{
@@ -47,11 +83,65 @@ var runCmd = &cobra.Command{
 		opts := gitkustomizediff.RunOpts{
 			Base:                    runOpts.base,
 			Target:                  runOpts.target,
+			Remote:                  runOpts.remote,
 			Debug:                   runOpts.debug,
+			Fetch:                   runOpts.fetch,
 			AllowDirty:              runOpts.allowDirty,
+			Staged:                  runOpts.staged,
 			KustomizePath:           runOpts.kustomizePath,
 			KustomizeLoadRestrictor: runOpts.kustomizeLoadRestrictor,
+			SkipUnchanged:           runOpts.skipUnchanged,
 			GitPath:                 runOpts.gitPath,
+			Strategy:                gitkustomizediff.Strategy(runOpts.strategy),
+			NoCheckout:              runOpts.noCheckout,
+			GitDir:                  runOpts.gitDir,
+			Origins:                 runOpts.origins,
+			RepoURL:                 runOpts.repoURL,
+			RepoProvider:            gitkustomizediff.RepoProvider(runOpts.repoProvider),
+			Capacity:                runOpts.capacity,
+		}
+		for _, flag := range analyzerFlags {
+			if cmd.Flags().Changed(flag.name) && !containsAny(runOpts.analyzers, flag.analyzers) {
+				return errors.Errorf("--%s needs the %s analyzer", flag.name, strings.Join(flag.analyzers, " or "))
+			}
+		}
+		analyzerOpts := gitkustomizediff.AnalyzerOpts{
+			PodSecurityStandards: runOpts.podSecurityStandards,
+			KubeVersion:          runOpts.kubeVersion,
+			SchemaFiles:          runOpts.schemaFiles,
+			CRDSchemaDirs:        runOpts.crdSchemaDirs,
+		}
+		for _, name := range runOpts.analyzers {
+			analyzer, err := gitkustomizediff.NewAnalyzer(name, analyzerOpts)
+			if err != nil {
+				return err
+			}
+			opts.Analyzers = append(opts.Analyzers, analyzer)
+		}
+		if len(runOpts.policies) > 0 {
+			analyzer, err := gitkustomizediff.LoadPolicyAnalyzer(runOpts.policies...)
+			if err != nil {
+				return err
+			}
+			opts.Analyzers = append(opts.Analyzers, analyzer)
+		}
+		if runOpts.images || len(runOpts.imagePaths) > 0 {
+			opts.Images = &gitkustomizediff.ImageInventory{}
+			for _, s := range runOpts.imagePaths {
+				path, err := gitkustomizediff.ParseImagePath(s)
+				if err != nil {
+					return err
+				}
+				opts.Images.CustomPaths = append(opts.Images.CustomPaths, path)
+			}
+		}
+		var failOn gitkustomizediff.Severity
+		if runOpts.failOn != "" {
+			var err error
+			failOn, err = gitkustomizediff.ParseSeverity(runOpts.failOn)
+			if err != nil {
+				return err
+			}
 		}
 		if runOpts.includeRegexpString != "" {
 			includeRegexp, err := regexp.Compile(runOpts.includeRegexpString)
@@ -68,18 +158,34 @@ var runCmd = &cobra.Command{
 			opts.ExcludeRegexp = excludeRegexp
 		}
 
+		cacheDir, err := resolveCacheDir(runOpts.cache, runOpts.cacheDir)
+		if err != nil {
+			return err
+		}
+		opts.CacheDir = cacheDir
+
 		dir := "."
 		if len(args) == 1 {
 			dir = args[0]
 		}
 		res, err := gitkustomizediff.Run(dir, opts)
 		if err != nil {
+			var conflictErr *utils.MergeConflictError
+			if errors.As(err, &conflictErr) {
+				printMergeConflict(conflictErr)
+				os.Exit(1)
+			}
 			fmt.Printf("%+v\n", err)
 			os.Exit(1)
 		}
 
 		printRunResult(dir, opts, res)
 
+		// A broken analyzer must not pass the gate.
+		if failOn != "" && (res.DiffMap.HasFindings(failOn) || len(res.DiffMap.AllAnalyzerErrors()) > 0) {
+			os.Exit(2)
+		}
+
 		return nil
 	},
 }
@@ -87,22 +193,74 @@ var runCmd = &cobra.Command{
 var runOpts runFlags
 
 func init() {
-	runCmd.PersistentFlags().StringVar(&runOpts.base, "base", "", "base commitish (default to origin/main)")
+	runCmd.PersistentFlags().StringVar(&runOpts.base, "base", "", "base commitish (default to the default branch of the remote)")
 	runCmd.PersistentFlags().StringVar(&runOpts.target, "target", "", "target commitish (default to the current branch)")
+	runCmd.PersistentFlags().StringVar(&runOpts.remote, "remote", "", "remote to detect the default branch from (default to origin)")
 	runCmd.PersistentFlags().StringVar(&runOpts.includeRegexpString, "include", "", "include regexp (default to all)")
 	runCmd.PersistentFlags().StringVar(&runOpts.excludeRegexpString, "exclude", "", "exclude regexp (default to none)")
 	runCmd.PersistentFlags().StringVar(&runOpts.kustomizePath, "kustomize-path", "", "path of a kustomize binary (default to embedded)")
 	runCmd.PersistentFlags().StringVar(&runOpts.kustomizeLoadRestrictor, "kustomize-load-restrictor", "", "kustomize load restrictor type (default to kustomizaton provider defaults)")
+	runCmd.PersistentFlags().BoolVar(&runOpts.cache, "cache", false, "cache build results on disk")
+	runCmd.PersistentFlags().StringVar(&runOpts.cacheDir, "cache-dir", "", "directory of the build cache, which enables the cache (default to the user cache dir)")
+	runCmd.PersistentFlags().BoolVar(&runOpts.skipUnchanged, "skip-unchanged", true, "skip building kustomizations whose input files are identical")
 	runCmd.PersistentFlags().StringVar(&runOpts.gitPath, "git-path", "", "path of a git binary (default to git)")
 	runCmd.PersistentFlags().BoolVar(&runOpts.debug, "debug", false, "debug mode")
-	runCmd.PersistentFlags().BoolVar(&runOpts.allowDirty, "allow-dirty", false, "allow dirty tree")
+	runCmd.PersistentFlags().BoolVar(&runOpts.fetch, "fetch", false, "fetch the remote before resolving the commits (default to offline)")
+	runCmd.PersistentFlags().BoolVar(&runOpts.allowDirty, "allow-dirty", false, "allow dirty tree including untracked files")
+	runCmd.PersistentFlags().BoolVar(&runOpts.staged, "staged", false, "diff only the staged changes of the dirty tree")
+	runCmd.PersistentFlags().StringVar(&runOpts.strategy, "strategy", string(gitkustomizediff.StrategyMerge), "comparison strategy (merge, merge-base or direct)")
+	runCmd.PersistentFlags().BoolVar(&runOpts.noCheckout, "no-checkout", false, "build from git objects without cloning the repo")
+	runCmd.PersistentFlags().StringVar(&runOpts.gitDir, "git-dir", "", "path of a bare repo or a git dir to read the commits from, which makes target_dir a path in the tree")
+	runCmd.PersistentFlags().BoolVar(&runOpts.origins, "origins", false, "resolve the changed resources to their source files")
+	runCmd.PersistentFlags().StringVar(&runOpts.repoURL, "repo-url", "", repoURLUsage+" (default to inferred from the remote with --origins)")
+	runCmd.PersistentFlags().StringVar(&runOpts.repoProvider, "repo-provider", "", repoProviderUsage)
+	runCmd.PersistentFlags().StringSliceVar(&runOpts.analyzers, "analyzers", nil, fmt.Sprintf("analyzers to run over the builds (%s)", strings.Join(gitkustomizediff.AnalyzerNames(), ", ")))
+	runCmd.PersistentFlags().StringVar(&runOpts.failOn, "fail-on", "", "exit with 2 if any finding has the severity (low, medium or high) or a higher one, or any analyzer fails")
+	runCmd.PersistentFlags().BoolVar(&runOpts.images, "images", false, "list the image changes of the containers")
+	runCmd.PersistentFlags().StringSliceVar(&runOpts.imagePaths, "image-path", nil, "path of containers or an image in custom resources, which enables --images (e.g. Rollout:spec.template.spec.containers)")
+	runCmd.PersistentFlags().BoolVar(&runOpts.capacity, "capacity", false, "summarize the changes of the requested and limited CPU and memory")
+	runCmd.PersistentFlags().BoolVar(&runOpts.podSecurityStandards, "pod-security-standards", false, "compare the Pod Security Standards levels with the podsecurity analyzer")
+	runCmd.PersistentFlags().StringSliceVar(&runOpts.policies, "policy", nil, "path of a policy file whose rules are evaluated on the target builds")
+	runCmd.PersistentFlags().StringVar(&runOpts.kubeVersion, "kube-version", "", fmt.Sprintf("Kubernetes version to check the target builds against with the deprecation and schema analyzers, where the bundled schemas are available only for %s (default to the latest one)", strings.Join(gitkustomizediff.SchemaVersions(), ", ")))
+	runCmd.PersistentFlags().StringSliceVar(&runOpts.schemaFiles, "schema-file", nil, "path of an OpenAPI swagger.json of Kubernetes to validate the target builds with the schema analyzer instead of the bundled schema")
+	runCmd.PersistentFlags().StringSliceVar(&runOpts.crdSchemaDirs, "crd-schema-dir", nil, "dir of the CRD manifests to validate the custom resources with the schema analyzer")
+}
+
+func containsAny(list []string, elems []string) bool {
+	for _, s := range list {
+		for _, elem := range elems {
+			if s == elem {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func printMergeConflict(err *utils.MergeConflictError) {
+	fmt.Printf("# Git Kustomize Diff\n\n")
+	fmt.Printf(":warning: Failed to merge %s due to conflicts in the following files.\n\n", err.Commit)
+	for _, file := range err.Files {
+		fmt.Printf("- %s\n", file)
+	}
 }
 
 func printRunResult(dirPath string, opts gitkustomizediff.RunOpts, res *gitkustomizediff.RunResult) {
 	dirs := res.DiffMap.Dirs()
 	fmt.Printf("# Git Kustomize Diff\n\n")
 
-	fmt.Printf("%s...%s\n\n", res.BaseCommit, res.TargetCommit)
+	fmt.Printf("%s\n\n", rangeLink(res.Links, res.BaseCommit, res.TargetCommit))
+
+	printAnalyzerErrors(res)
+	for _, analyzer := range opts.Analyzers {
+		printFindings(res, analyzer)
+	}
+	if opts.Images != nil {
+		printImageChanges(res)
+	}
+	if opts.Capacity {
+		printCapacityDeltas(res)
+	}
 
 	fmt.Printf("<details><summary>Options</summary>\n\n")
 	fmt.Println("| name | value |")
@@ -110,6 +268,7 @@ func printRunResult(dirPath string, opts gitkustomizediff.RunOpts, res *gitkusto
 	fmt.Printf("| dir | %s |\n", dirPath)
 	fmt.Printf("| base | %s |\n", opts.Base)
 	fmt.Printf("| target | %s |\n", opts.Target)
+	fmt.Printf("| strategy | %s |\n", opts.Strategy)
 	includeRegexp := ""
 	if opts.IncludeRegexp != nil {
 		includeRegexp = opts.IncludeRegexp.String()
@@ -122,6 +281,8 @@ func printRunResult(dirPath string, opts gitkustomizediff.RunOpts, res *gitkusto
 	fmt.Printf("| exclude | %s |\n", strings.ReplaceAll(excludeRegexp, "|", "\\|"))
 	fmt.Printf("\n</details>\n\n")
 
+	printCommits(res.Links, []namedCommit{{"base", res.Base}, {"target", res.Target}, {"merge base", res.MergeBase}})
+
 	fmt.Printf("<details><summary>Target Kustomizations</summary>\n\n")
 	if len(dirs) > 0 {
 		fmt.Printf("```\n%s\n```\n", strings.Join(dirs, "\n"))
@@ -130,11 +291,43 @@ func printRunResult(dirPath string, opts gitkustomizediff.RunOpts, res *gitkusto
 	}
 	fmt.Printf("\n</details>\n\n")
 
+	if len(res.DiffMap.RemoteInputs) > 0 {
+		fmt.Printf("<details><summary>Kustomizations with Remote Inputs</summary>\n\n")
+		for _, dir := range dirs {
+			if remote, ok := res.DiffMap.RemoteInputs[dir]; ok {
+				fmt.Printf("- %s: %s\n", dir, strings.Join(remote, ", "))
+			}
+		}
+		fmt.Printf("\n</details>\n\n")
+	}
+
+	if len(res.SubmoduleChanges) > 0 {
+		fmt.Printf("## Submodule Changes\n\n")
+		fmt.Println("| path | old | new | kustomizations |")
+		fmt.Println("|-|-|-|-|")
+		for _, change := range res.SubmoduleChanges {
+			fmt.Printf("| %s | %s | %s | %s |\n", change.Path, change.OldCommit, change.NewCommit, strings.Join(change.Dirs, ", "))
+		}
+		fmt.Println()
+	}
+
 	found := false
 	for _, dir := range dirs {
 		text := res.DiffMap.Results[dir].AsMarkdown()
 		if text != "" {
-			fmt.Printf("## %s\n\n", dir)
+			fmt.Printf("## %s\n\n", kustomizationLink(res.Links, runDirCommit(res, dir), dir, res.DiffMap.KustomizationFiles[dir]))
+			if content, ok := res.DiffMap.Results[dir].(*gitkustomizediff.DiffContent); ok && len(content.Sources) > 0 {
+				fmt.Println("| resource | change | sources |")
+				fmt.Println("|-|-|-|")
+				for _, source := range content.Sources {
+					links := make([]string, 0, len(source.Files))
+					for _, file := range source.Files {
+						links = append(links, sourceLink(res, source.Type, file))
+					}
+					fmt.Printf("| %s | %s | %s |\n", source.ID, source.Type, strings.Join(links, ", "))
+				}
+				fmt.Println()
+			}
 			fmt.Printf("<details><summary>diff</summary>\n\n")
 			fmt.Println(text)
 			fmt.Printf("\n</details>\n\n")
@@ -145,3 +338,195 @@ func printRunResult(dirPath string, opts gitkustomizediff.RunOpts, res *gitkusto
 		fmt.Println(":tada::tada: No Diff :tada::tada:")
 	}
 }
+
+type namedCommit struct {
+	name string
+	info *utils.CommitInfo
+}
+
+// printCommits prints the commits in a collapsed table skipping nil ones.
+func printCommits(links *gitkustomizediff.RepoLinks, commits []namedCommit) {
+	fmt.Printf("<details><summary>Commits</summary>\n\n")
+	fmt.Println("| name | ref | commit | subject | author | time |")
+	fmt.Println("|-|-|-|-|-|-|")
+	for _, c := range commits {
+		if c.info == nil {
+			continue
+		}
+		ref := c.info.Ref
+		if ref == c.info.Hash {
+			ref = "-"
+		}
+		fmt.Printf("| %s | %s | %s | %s | %s <%s> | %s |\n", c.name, ref, commitLink(links, c.info.Hash), strings.ReplaceAll(c.info.Subject, "|", "\\|"), c.info.Author, c.info.Email, c.info.Time.Format(time.RFC3339))
+	}
+	fmt.Printf("\n</details>\n\n")
+}
+
+func printAnalyzerErrors(res *gitkustomizediff.RunResult) {
+	analyzerErrors := res.DiffMap.AllAnalyzerErrors()
+	if len(analyzerErrors) == 0 {
+		return
+	}
+	fmt.Printf("## Analyzer Errors\n\n")
+	fmt.Println("| analyzer | kustomization | error |")
+	fmt.Println("|-|-|-|")
+	for _, analyzerErr := range analyzerErrors {
+		message := strings.ReplaceAll(strings.ReplaceAll(analyzerErr.Err.Error(), "\n", " "), "|", "\\|")
+		fmt.Printf("| %s | %s | %s |\n", analyzerErr.Analyzer, dirLink(res.Links, runDirCommit(res, analyzerErr.Dir), analyzerErr.Dir), message)
+	}
+	fmt.Println()
+}
+
+func printFindings(res *gitkustomizediff.RunResult, analyzer gitkustomizediff.Analyzer) {
+	findings := res.DiffMap.AnalyzerFindings(analyzer.Name())
+	if len(findings) == 0 {
+		return
+	}
+	newFindings := make([]*gitkustomizediff.Finding, 0)
+	existingFindings := make([]*gitkustomizediff.Finding, 0)
+	for _, finding := range findings {
+		if finding.Existing {
+			existingFindings = append(existingFindings, finding)
+		} else {
+			newFindings = append(newFindings, finding)
+		}
+	}
+	fmt.Printf("## %s\n\n", analyzer.Title())
+	if len(newFindings) > 0 {
+		printFindingTable(res, newFindings)
+	}
+	if len(existingFindings) > 0 {
+		fmt.Printf("<details><summary>Pre-existing (%d)</summary>\n\n", len(existingFindings))
+		printFindingTable(res, existingFindings)
+		fmt.Printf("</details>\n\n")
+	}
+}
+
+func printFindingTable(res *gitkustomizediff.RunResult, findings []*gitkustomizediff.Finding) {
+	fmt.Println("| severity | kustomization | resource | finding |")
+	fmt.Println("|-|-|-|-|")
+	for _, finding := range findings {
+		fmt.Printf("| %s | %s | %s | %s |\n", finding.Severity, dirLink(res.Links, runDirCommit(res, finding.Dir), finding.Dir), finding.ID, strings.ReplaceAll(finding.Message, "|", "\\|"))
+	}
+	fmt.Println()
+}
+
+func printImageChanges(res *gitkustomizediff.RunResult) {
+	fmt.Printf("## Image Changes\n\n")
+	found := false
+	for _, dir := range res.DiffMap.Dirs() {
+		for _, change := range res.DiffMap.ImageChanges[dir] {
+			if !found {
+				fmt.Println("| kustomization | resource | container | image | change |")
+				fmt.Println("|-|-|-|-|-|")
+				found = true
+			}
+			container := change.Container
+			if change.Init {
+				container += " (init)"
+			}
+			image, text := imageChange(change.OldImage, change.NewImage)
+			fmt.Printf("| %s | %s | %s | %s | %s |\n", dirLink(res.Links, runDirCommit(res, dir), dir), change.ID, container, image, text)
+		}
+	}
+	if !found {
+		fmt.Println("N/A")
+	}
+	fmt.Println()
+}
+
+// imageChange shows only the tags or digests if the image names are the same.
+func imageChange(oldImage, newImage string) (string, string) {
+	oldName, oldRef := gitkustomizediff.SplitImage(oldImage)
+	newName, newRef := gitkustomizediff.SplitImage(newImage)
+	switch {
+	case oldImage == "":
+		return newName, fmt.Sprintf("added `%s`", newImage)
+	case newImage == "":
+		return oldName, fmt.Sprintf("removed `%s`", oldImage)
+	case oldName == newName && oldRef != "" && newRef != "":
+		return newName, fmt.Sprintf("`%s` -> `%s`", oldRef, newRef)
+	default:
+		return "-", fmt.Sprintf("`%s` -> `%s`", oldImage, newImage)
+	}
+}
+
+func printCapacityDeltas(res *gitkustomizediff.RunResult) {
+	fmt.Printf("## Capacity Changes\n\n")
+	deltas := res.DiffMap.CapacityDeltasByNamespace()
+	if len(deltas) == 0 {
+		fmt.Printf("N/A\n\n")
+		return
+	}
+	header := "| cpu requests | cpu limits | memory requests | memory limits |"
+	fmt.Printf("| namespace %s\n", header)
+	fmt.Println("|-|-|-|-|-|")
+	for _, delta := range deltas {
+		fmt.Printf("| %s %s\n", capacityNamespace(delta.Namespace), capacityRow(delta))
+	}
+	fmt.Println()
+
+	fmt.Printf("<details><summary>By kustomization</summary>\n\n")
+	fmt.Printf("| kustomization | namespace %s\n", header)
+	fmt.Println("|-|-|-|-|-|-|")
+	for _, dir := range res.DiffMap.Dirs() {
+		for _, delta := range res.DiffMap.CapacityDeltas[dir] {
+			fmt.Printf("| %s | %s %s\n", dirLink(res.Links, runDirCommit(res, dir), dir), capacityNamespace(delta.Namespace), capacityRow(delta))
+		}
+	}
+	fmt.Printf("\n</details>\n\n")
+}
+
+func capacityNamespace(namespace string) string {
+	if namespace == "" {
+		return "-"
+	}
+	return namespace
+}
+
+func capacityRow(delta *gitkustomizediff.CapacityDelta) string {
+	row := "|"
+	for _, c := range []struct {
+		value  func(gitkustomizediff.Capacity) int64
+		format func(int64) string
+	}{
+		{func(c gitkustomizediff.Capacity) int64 { return c.CPURequests }, gitkustomizediff.FormatCPU},
+		{func(c gitkustomizediff.Capacity) int64 { return c.CPULimits }, gitkustomizediff.FormatCPU},
+		{func(c gitkustomizediff.Capacity) int64 { return c.MemoryRequests }, gitkustomizediff.FormatMemory},
+		{func(c gitkustomizediff.Capacity) int64 { return c.MemoryLimits }, gitkustomizediff.FormatMemory},
+	} {
+		baseMin, baseMax := c.value(delta.Base.Min), c.value(delta.Base.Max)
+		targetMin, targetMax := c.value(delta.Target.Min), c.value(delta.Target.Max)
+		formatRange := func(min, max int64, signed bool) string {
+			format := func(v int64) string {
+				if signed && v > 0 {
+					return "+" + c.format(v)
+				}
+				return c.format(v)
+			}
+			if min == max {
+				return format(min)
+			}
+			return fmt.Sprintf("%s..%s", format(min), format(max))
+		}
+		row += fmt.Sprintf(" %s (%s -> %s) |", formatRange(targetMin-baseMin, targetMax-baseMax, true), formatRange(baseMin, baseMax, false), formatRange(targetMin, targetMax, false))
+	}
+	return row
+}
+
+// runDirCommit returns the base commit for the kustomizations removed on the
+// target side.
+func runDirCommit(res *gitkustomizediff.RunResult, dir string) string {
+	if _, ok := res.DiffMap.KustomizationFiles[dir]; ok {
+		return res.TargetCommit
+	}
+	return res.BaseCommit
+}
+
+func sourceLink(res *gitkustomizediff.RunResult, diffType gitkustomizediff.ResourceDiffType, file string) string {
+	// Remote files are in the form of repo//path?ref=ref.
+	if res.Links == nil || strings.Contains(file, "//") {
+		return fmt.Sprintf("`%s`", file)
+	}
+	return markdownLink(file, res.Links.BlobURL(res.SourceCommit(diffType), file))
+}
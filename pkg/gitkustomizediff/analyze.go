@@ -0,0 +1,226 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+type Severity string
+
+const (
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+var severityRanks = map[Severity]int{
+	SeverityLow:    1,
+	SeverityMedium: 2,
+	SeverityHigh:   3,
+}
+
+func ParseSeverity(s string) (Severity, error) {
+	severity := Severity(s)
+	if _, ok := severityRanks[severity]; !ok {
+		return "", errors.Errorf("unknown severity: %q", s)
+	}
+	return severity, nil
+}
+
+// AtLeast returns true if the severity is equal to or higher than the other.
+func (s Severity) AtLeast(other Severity) bool {
+	return severityRanks[s] >= severityRanks[other]
+}
+
+type Finding struct {
+	Analyzer string
+	Severity Severity
+	// Dir is the kustomization dir the resource is built from.
+	Dir     string
+	ID      ResourceID
+	Message string
+	// Existing is true if the finding applies to the base build as well.
+	Existing bool
+}
+
+// Analyzer inspects the parsed base and target builds of a kustomization.
+// Either side is empty if the kustomization doesn't exist there.
+type Analyzer interface {
+	Name() string
+	Title() string
+	Analyze(base, target []*Resource) ([]*Finding, error)
+}
+
+// DirAnalyzer is an analyzer which depends on the kustomization dir.
+type DirAnalyzer interface {
+	Analyzer
+	AnalyzeDir(dir string, base, target []*Resource) ([]*Finding, error)
+}
+
+// AnalyzerOpts are the options of the analyzers which need configuration.
+type AnalyzerOpts struct {
+	// PodSecurityStandards is used by podsecurity.
+	PodSecurityStandards bool
+	// KubeVersion is used by deprecation and schema.
+	KubeVersion string
+	// SchemaFiles and CRDSchemaDirs are used by schema.
+	SchemaFiles   []string
+	CRDSchemaDirs []string
+}
+
+var analyzerFactories = map[string]func(opts AnalyzerOpts) (Analyzer, error){
+	"deprecation": func(opts AnalyzerOpts) (Analyzer, error) {
+		analyzer, err := NewDeprecationAnalyzer(opts.KubeVersion)
+		if err != nil {
+			return nil, err
+		}
+		return analyzer, nil
+	},
+	"exposure": func(opts AnalyzerOpts) (Analyzer, error) { return &ExposureAnalyzer{}, nil },
+	"podsecurity": func(opts AnalyzerOpts) (Analyzer, error) {
+		return &PodSecurityAnalyzer{Standards: opts.PodSecurityStandards}, nil
+	},
+	"rbac":      func(opts AnalyzerOpts) (Analyzer, error) { return &RBACAnalyzer{}, nil },
+	"reference": func(opts AnalyzerOpts) (Analyzer, error) { return &ReferenceAnalyzer{}, nil },
+	"risk":      func(opts AnalyzerOpts) (Analyzer, error) { return &RiskAnalyzer{}, nil },
+	"schema": func(opts AnalyzerOpts) (Analyzer, error) {
+		analyzer, err := NewSchemaAnalyzer(opts.KubeVersion, opts.SchemaFiles, opts.CRDSchemaDirs)
+		if err != nil {
+			return nil, err
+		}
+		return analyzer, nil
+	},
+}
+
+// NewAnalyzer returns the analyzer of the name configured with the options.
+func NewAnalyzer(name string, opts AnalyzerOpts) (Analyzer, error) {
+	factory, ok := analyzerFactories[name]
+	if !ok {
+		return nil, errors.Errorf("unknown analyzer: %q", name)
+	}
+	return factory(opts)
+}
+
+func AnalyzerNames() []string {
+	names := make([]string, 0, len(analyzerFactories))
+	for name := range analyzerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AnalyzerError is an error of an analyzer on a kustomization, which doesn't
+// stop the other analyzers.
+type AnalyzerError struct {
+	Analyzer string
+	Dir      string
+	Err      error
+}
+
+func (e *AnalyzerError) Error() string {
+	return fmt.Sprintf("%s failed on %s: %v", e.Analyzer, e.Dir, e.Err)
+}
+
+func analyze(analyzers []Analyzer, kDir string, baseResources, targetResources []*Resource) ([]*Finding, []*AnalyzerError) {
+	findings := make([]*Finding, 0)
+	analyzerErrors := make([]*AnalyzerError, 0)
+	for _, analyzer := range analyzers {
+		var res []*Finding
+		var err error
+		if dirAnalyzer, ok := analyzer.(DirAnalyzer); ok {
+			res, err = dirAnalyzer.AnalyzeDir(kDir, baseResources, targetResources)
+		} else {
+			res, err = analyzer.Analyze(baseResources, targetResources)
+		}
+		if err != nil {
+			analyzerErrors = append(analyzerErrors, &AnalyzerError{Analyzer: analyzer.Name(), Dir: kDir, Err: err})
+			continue
+		}
+		for _, finding := range res {
+			finding.Analyzer = analyzer.Name()
+			finding.Dir = kDir
+		}
+		findings = append(findings, res...)
+	}
+	return findings, analyzerErrors
+}
+
+func resourceMap(resources []*Resource) map[ResourceID]*Resource {
+	m := make(map[ResourceID]*Resource, len(resources))
+	for _, res := range resources {
+		m[res.ID] = res
+	}
+	return m
+}
+
+// fieldChanged compares the field of the resources, which is regarded as
+// changed when it's added or removed as well.
+func fieldChanged(base, target *Resource, path string) bool {
+	baseValue, baseOk := base.Field(path)
+	targetValue, targetOk := target.Field(path)
+	if baseOk != targetOk {
+		return true
+	}
+	return !reflect.DeepEqual(baseValue, targetValue)
+}
+
+// stringsDifference returns the sorted unique strings in a but not in b.
+func stringsDifference(a, b []string) []string {
+	bSet := make(map[string]struct{}, len(b))
+	for _, s := range b {
+		bSet[s] = struct{}{}
+	}
+	aSet := make(map[string]struct{}, len(a))
+	for _, s := range a {
+		if _, ok := bSet[s]; !ok {
+			aSet[s] = struct{}{}
+		}
+	}
+	diff := make([]string, 0, len(aSet))
+	for s := range aSet {
+		diff = append(diff, s)
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// optionalFieldString returns an empty string if the resource is nil or
+// doesn't have the field.
+func optionalFieldString(res *Resource, path string) string {
+	if res == nil {
+		return ""
+	}
+	value, ok := res.Field(path)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// valueString formats a field value in a message.
+func valueString(value interface{}, ok bool) string {
+	if !ok {
+		return "none"
+	}
+	return fmt.Sprintf("`%v`", value)
+}
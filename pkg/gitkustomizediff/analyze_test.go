@@ -0,0 +1,41 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parseTestBuilds parses the builds of the base and target, where an empty
+// YAML is an empty build.
+func parseTestBuilds(t *testing.T, baseYaml, targetYaml string) ([]*Resource, []*Resource) {
+	base, target, err := parseBuilds(baseYaml, targetYaml)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return base, target
+}
+
+func analyzeTestBuilds(t *testing.T, analyzer Analyzer, base, target []*Resource) []*Finding {
+	findings, err := analyzer.Analyze(base, target)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return findings
+}
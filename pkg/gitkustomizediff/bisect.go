@@ -0,0 +1,240 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	bisectStateBuildFails    = "build fails"
+	bisectStateBuildSucceeds = "build succeeds"
+	bisectStateMissing       = "<missing>"
+	bisectStateMatched       = "matched"
+	bisectStateNotMatched    = "not matched"
+	bisectStateMultipleFound = "<multiple resources>"
+)
+
+type BisectPredicate struct {
+	BuildFails bool
+	Selector   ResourceSelector
+	FieldPath  string
+	Value      *string
+}
+
+// Evaluate returns the state of the predicate for a build. Bisect looks for
+// the first commit where the state differs from the one of the good commit.
+func (p BisectPredicate) Evaluate(buildYaml string, buildErr error) string {
+	if p.BuildFails {
+		if buildErr != nil {
+			return bisectStateBuildFails
+		}
+		return bisectStateBuildSucceeds
+	}
+	if buildErr != nil {
+		return bisectStateBuildFails
+	}
+	resources, err := ParseResources(buildYaml)
+	if err != nil {
+		return bisectStateBuildFails
+	}
+	var found *Resource
+	for _, res := range resources {
+		if p.Selector.Match(res.ID) {
+			if found != nil {
+				return bisectStateMultipleFound
+			}
+			found = res
+		}
+	}
+	state := bisectStateMissing
+	if found != nil {
+		if value, ok := found.Field(p.FieldPath); ok {
+			state = fmt.Sprintf("%v", value)
+		}
+	}
+	if p.Value != nil {
+		if state == *p.Value {
+			return bisectStateMatched
+		}
+		return bisectStateNotMatched
+	}
+	return state
+}
+
+type BisectOpts struct {
+	Good                    string
+	Bad                     string
+	Remote                  string
+	Predicate               BisectPredicate
+	KustomizePath           string
+	KustomizeLoadRestrictor string
+	CacheDir                string
+	GitPath                 string
+	Debug                   bool
+	Fetch                   bool
+	RepoURL                 string
+	RepoProvider            RepoProvider
+}
+
+type BisectStep struct {
+	Commit string
+	State  string
+}
+
+type BisectResult struct {
+	GoodCommit  string
+	BadCommit   string
+	Good        *utils.CommitInfo
+	Bad         *utils.CommitInfo
+	GoodState   string
+	FirstCommit string
+	FirstState  string
+	Subject     string
+	Steps       []*BisectStep
+	// Links is nil without a repo URL.
+	Links *RepoLinks
+}
+
+func Bisect(dirPath, kDir string, opts BisectOpts) (*BisectResult, error) {
+	log.Info("Start bisect")
+	if !opts.Predicate.BuildFails && opts.Predicate.FieldPath == "" {
+		return nil, errors.New("either a field path or build failure is required as a predicate")
+	}
+	currentGitDir := utils.NewGitDir(dirPath, opts.GitPath)
+	if opts.Fetch {
+		err := fetch(currentGitDir, opts.Remote)
+		if err != nil {
+			return nil, err
+		}
+	}
+	good, bad, err := resolveCommits(currentGitDir, opts.Remote, opts.Good, opts.Bad)
+	if err != nil {
+		return nil, err
+	}
+	goodCommit, badCommit := good.Hash, bad.Hash
+	links, err := resolveRepoLinks(currentGitDir, opts.RepoURL, opts.RepoProvider, "")
+	if err != nil {
+		return nil, err
+	}
+	// The predicate is monotonic only along the first parents, so a change in
+	// a merged branch is found as the merge commit.
+	commits, err := currentGitDir.RevList("--reverse", "--first-parent", fmt.Sprintf("%s..%s", goodCommit, badCommit))
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, errors.Errorf("no commits between %s and %s", goodCommit, badCommit)
+	}
+
+	log.Infof("Clone the git repo at %s", goodCommit)
+	tmpDirPath, err := ioutil.TempDir("", "git-kustomize-diff-bisect-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if opts.Debug {
+		log.Infof("Bisect repo path: %s", tmpDirPath)
+	} else {
+		defer os.RemoveAll(tmpDirPath)
+	}
+	gitDir, err := currentGitDir.CloneAndCheckout(tmpDirPath, goodCommit)
+	if err != nil {
+		return nil, err
+	}
+
+	buildOpts := BuildOpts{
+		KustomizePath:           opts.KustomizePath,
+		KustomizeLoadRestrictor: opts.KustomizeLoadRestrictor,
+		CacheDir:                opts.CacheDir,
+	}
+	res := &BisectResult{
+		GoodCommit: goodCommit,
+		BadCommit:  badCommit,
+		Good:       good,
+		Bad:        bad,
+		Steps:      make([]*BisectStep, 0),
+		Links:      links,
+	}
+	evaluate := func(commit string) (string, error) {
+		err := gitDir.Clean()
+		if err != nil {
+			return "", err
+		}
+		err = gitDir.Checkout(commit)
+		if err != nil {
+			return "", err
+		}
+		kDirPath := filepath.Join(gitDir.WorkDir.Dir, kDir)
+		var buildYaml string
+		var buildErr error
+		if utils.KustomizationExists(kDirPath) {
+			buildYaml, buildErr = Build(kDirPath, buildOpts)
+		} else {
+			buildErr = errors.Errorf("kustomization not found: %s", kDir)
+		}
+		state := opts.Predicate.Evaluate(buildYaml, buildErr)
+		log.Infof("State at %s: %s", commit, state)
+		res.Steps = append(res.Steps, &BisectStep{Commit: commit, State: state})
+		return state, nil
+	}
+
+	res.GoodState, err = evaluate(goodCommit)
+	if err != nil {
+		return nil, err
+	}
+	badState, err := evaluate(commits[len(commits)-1])
+	if err != nil {
+		return nil, err
+	}
+	if badState == res.GoodState {
+		return nil, errors.Errorf("the predicate does not flip between %s and %s: %s", goodCommit, badCommit, badState)
+	}
+
+	// Invariant: commits[lo-1] (or good) keeps the good state, commits[hi] flips.
+	lo, hi := 0, len(commits)-1
+	res.FirstState = badState
+	for lo < hi {
+		mid := (lo + hi) / 2
+		state, err := evaluate(commits[mid])
+		if err != nil {
+			return nil, err
+		}
+		if state == res.GoodState {
+			lo = mid + 1
+		} else {
+			hi = mid
+			res.FirstState = state
+		}
+	}
+	res.FirstCommit, err = currentGitDir.CommitHash(commits[hi])
+	if err != nil {
+		return nil, err
+	}
+	first, err := currentGitDir.CommitInfo(res.FirstCommit)
+	if err != nil {
+		return nil, err
+	}
+	res.Subject = first.Subject
+	return res, nil
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBisect(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.writePod("foo", "foo", "nginx:1.0")
+	goodCommit := repo.commit("initial")
+	repo.writePod("bar", "bar", "nginx:1.0")
+	repo.commit("add bar")
+	repo.writePod("foo", "foo", "nginx:1.1")
+	bumpCommit := repo.commit("bump foo")
+	repo.write("README.md", "readme\n")
+	repo.commit("add readme")
+	repo.write("foo/kustomization.yaml", "resources:\n- missing.yaml\n")
+	brokenCommit := repo.commit("break foo")
+	repo.write("CHANGELOG.md", "changelog\n")
+	badCommit := repo.commit("add changelog")
+
+	value := "nginx:1.1"
+	res, err := Bisect(repo.workDir.Dir, "foo", BisectOpts{
+		Good: goodCommit,
+		Bad:  badCommit,
+		Predicate: BisectPredicate{
+			Selector:  ResourceSelector{Kind: "Pod", Name: "foo"},
+			FieldPath: "spec.containers[name=foo].image",
+			Value:     &value,
+		},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, goodCommit, res.GoodCommit)
+	assert.Equal(t, badCommit, res.BadCommit)
+	assert.Equal(t, "initial", res.Good.Subject)
+	assert.Equal(t, "add changelog", res.Bad.Subject)
+	assert.Equal(t, bumpCommit, res.FirstCommit)
+	assert.Equal(t, "bump foo", res.Subject)
+	assert.Equal(t, "not matched", res.GoodState)
+	assert.Equal(t, "matched", res.FirstState)
+
+	res, err = Bisect(repo.workDir.Dir, "foo", BisectOpts{
+		Good: goodCommit,
+		Bad:  bumpCommit,
+		Predicate: BisectPredicate{
+			Selector:  ResourceSelector{Kind: "Pod", Name: "foo"},
+			FieldPath: "spec.containers[0].image",
+		},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, bumpCommit, res.FirstCommit)
+	assert.Equal(t, "nginx:1.0", res.GoodState)
+	assert.Equal(t, "nginx:1.1", res.FirstState)
+
+	res, err = Bisect(repo.workDir.Dir, "foo", BisectOpts{
+		Good:      goodCommit,
+		Bad:       badCommit,
+		Predicate: BisectPredicate{BuildFails: true},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, brokenCommit, res.FirstCommit)
+	assert.Equal(t, "build succeeds", res.GoodState)
+	assert.Equal(t, "build fails", res.FirstState)
+
+	_, err = Bisect(repo.workDir.Dir, "bar", BisectOpts{
+		Good:      bumpCommit,
+		Bad:       badCommit,
+		Predicate: BisectPredicate{BuildFails: true},
+	})
+	assert.Error(t, err)
+}
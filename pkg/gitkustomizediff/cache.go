@@ -0,0 +1,159 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const cacheFormatVersion = "1"
+
+type BuildCache struct {
+	Dir string
+}
+
+func NewBuildCache(dirPath string) *BuildCache {
+	return &BuildCache{Dir: dirPath}
+}
+
+func DefaultBuildCacheDir() (string, error) {
+	dirPath, err := os.UserCacheDir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return filepath.Join(dirPath, "git-kustomize-diff"), nil
+}
+
+// Key returns a key computed from the content of all the input files of the
+// kustomization and the build options. An empty key is returned when the
+// build depends on remote inputs which can't be hashed.
+func (c *BuildCache) Key(dirPath string, opts BuildOpts) (string, error) {
+	fSys := opts.fileSystem()
+	inputs, err := utils.ListKustomizationInputs(fSys, dirPath)
+	if err != nil {
+		return "", err
+	}
+	if len(inputs.Remote) > 0 {
+		log.Debugf("Skip the build cache of %s due to remote inputs: %+v", dirPath, inputs.Remote)
+		return "", nil
+	}
+	version, err := builderVersion(opts.KustomizePath)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "format:%s\n", cacheFormatVersion)
+	fmt.Fprintf(h, "builder:%s\n", version)
+	fmt.Fprintf(h, "kustomizePath:%s\n", opts.KustomizePath)
+	fmt.Fprintf(h, "kustomizeLoadRestrictor:%s\n", opts.KustomizeLoadRestrictor)
+	if opts.Origins {
+		fmt.Fprintf(h, "origins:%t\n", opts.Origins)
+	}
+	for _, file := range inputs.Files {
+		relPath, err := filepath.Rel(dirPath, file)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		bs, err := fSys.ReadFile(file)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		fmt.Fprintf(h, "file:%s:%x\n", filepath.ToSlash(relPath), sha256.Sum256(bs))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *BuildCache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".yaml")
+}
+
+func (c *BuildCache) Get(key string) (string, bool, error) {
+	bs, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, errors.WithStack(err)
+	}
+	return string(bs), true, nil
+}
+
+func (c *BuildCache) Put(key, content string) error {
+	path := c.path(key)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// Write into a temporary file first not to expose a partial entry to concurrent runs.
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), key+".tmp-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write([]byte(content))
+	if err != nil {
+		tmpFile.Close()
+		return errors.WithStack(err)
+	}
+	err = tmpFile.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmpFile.Name(), path))
+}
+
+var builderVersions = map[string]string{}
+var builderVersionsMutex sync.Mutex
+
+func builderVersion(kustomizePath string) (string, error) {
+	builderVersionsMutex.Lock()
+	defer builderVersionsMutex.Unlock()
+	if version, ok := builderVersions[kustomizePath]; ok {
+		return version, nil
+	}
+	version := ""
+	if kustomizePath != "" {
+		stdout, _, err := (&utils.WorkDir{}).RunCommand(kustomizePath, "version")
+		if err != nil {
+			return "", err
+		}
+		version = strings.TrimSpace(stdout)
+	} else {
+		version = "embedded"
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, dep := range info.Deps {
+				if dep.Path == "sigs.k8s.io/kustomize/api" || dep.Path == "sigs.k8s.io/kustomize/kyaml" {
+					version += fmt.Sprintf(" %s@%s", dep.Path, dep.Version)
+				}
+			}
+		}
+	}
+	builderVersions[kustomizePath] = version
+	return version, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildCache(t *testing.T) {
+	cacheDirPath, err := ioutil.TempDir("", "kustomize-diff-test-cache-")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.RemoveAll(cacheDirPath)
+
+	repo := newTestRepo(t)
+	repo.writePod("a/foo", "foo", "nginx:1.0")
+	repo.writePod("b/foo", "foo", "nginx:1.0")
+	repo.writePod("c/foo", "foo", "nginx:1.1")
+
+	cache := NewBuildCache(cacheDirPath)
+	keyA, err := cache.Key(filepath.Join(repo.workDir.Dir, "a", "foo"), BuildOpts{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	keyB, err := cache.Key(filepath.Join(repo.workDir.Dir, "b", "foo"), BuildOpts{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	keyC, err := cache.Key(filepath.Join(repo.workDir.Dir, "c", "foo"), BuildOpts{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	keyD, err := cache.Key(filepath.Join(repo.workDir.Dir, "a", "foo"), BuildOpts{KustomizeLoadRestrictor: "LoadRestrictionsNone"})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, keyA, keyB)
+	assert.NotEqual(t, keyA, keyC)
+	assert.NotEqual(t, keyA, keyD)
+
+	_, ok, err := cache.Get(keyA)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	buildOpts := BuildOpts{CacheDir: cacheDirPath}
+	expectedYaml, err := Build(filepath.Join(repo.workDir.Dir, "a", "foo"), buildOpts)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	content, ok, err := cache.Get(keyA)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, expectedYaml, content)
+
+	// The build of b/foo is served from the entry of a/foo.
+	assert.NoError(t, cache.Put(keyA, "cached"))
+	actualYaml, err := Build(filepath.Join(repo.workDir.Dir, "b", "foo"), buildOpts)
+	assert.NoError(t, err)
+	assert.Equal(t, "cached", actualYaml)
+
+	repo.write("remote/kustomization.yaml", "resources:\n- github.com/example/repo//base?ref=v1.0.0\n")
+	key, err := cache.Key(filepath.Join(repo.workDir.Dir, "remote"), BuildOpts{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", key)
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Capacity is the total of the container resources. CPU is in millicores and
+// memory is in bytes.
+type Capacity struct {
+	CPURequests    int64
+	CPULimits      int64
+	MemoryRequests int64
+	MemoryLimits   int64
+}
+
+func (c Capacity) add(other Capacity, times int64) Capacity {
+	return Capacity{
+		CPURequests:    c.CPURequests + other.CPURequests*times,
+		CPULimits:      c.CPULimits + other.CPULimits*times,
+		MemoryRequests: c.MemoryRequests + other.MemoryRequests*times,
+		MemoryLimits:   c.MemoryLimits + other.MemoryLimits*times,
+	}
+}
+
+func (c Capacity) max(other Capacity) Capacity {
+	return Capacity{
+		CPURequests:    maxInt64(c.CPURequests, other.CPURequests),
+		CPULimits:      maxInt64(c.CPULimits, other.CPULimits),
+		MemoryRequests: maxInt64(c.MemoryRequests, other.MemoryRequests),
+		MemoryLimits:   maxInt64(c.MemoryLimits, other.MemoryLimits),
+	}
+}
+
+// CapacityRange is the capacity with the minimum and maximum replicas, which
+// differ only with HorizontalPodAutoscalers.
+type CapacityRange struct {
+	Min Capacity
+	Max Capacity
+}
+
+func (r CapacityRange) Add(other CapacityRange) CapacityRange {
+	return CapacityRange{
+		Min: r.Min.add(other.Min, 1),
+		Max: r.Max.add(other.Max, 1),
+	}
+}
+
+type CapacityDelta struct {
+	// Namespace is empty for the workloads without a namespace.
+	Namespace string
+	Base      CapacityRange
+	Target    CapacityRange
+}
+
+type autoscalerKey struct {
+	Namespace string
+	Kind      string
+	Name      string
+}
+
+// CapacityByNamespace sums up the container resources of the workloads
+// multiplied by the replicas. DaemonSets are counted once as the number of
+// nodes is unknown.
+func CapacityByNamespace(resources []*Resource) map[string]CapacityRange {
+	autoscalers := map[autoscalerKey][2]int64{}
+	for _, res := range resources {
+		if res.ID.Kind != "HorizontalPodAutoscaler" {
+			continue
+		}
+		kind, _ := res.Field("spec.scaleTargetRef.kind")
+		name, _ := res.Field("spec.scaleTargetRef.name")
+		maxReplicas, ok := intField(res, "spec.maxReplicas")
+		if !ok {
+			continue
+		}
+		minReplicas, ok := intField(res, "spec.minReplicas")
+		if !ok {
+			minReplicas = 1
+		}
+		autoscalers[autoscalerKey{res.ID.Namespace, fmt.Sprint(kind), fmt.Sprint(name)}] = [2]int64{minReplicas, maxReplicas}
+	}
+
+	capacities := map[string]CapacityRange{}
+	for _, res := range resources {
+		podSpecPath, ok := podSpecPaths[res.ID.Kind]
+		if !ok {
+			continue
+		}
+		podSpec, ok := res.Field(podSpecPath)
+		if !ok {
+			continue
+		}
+		replicas := int64(1)
+		switch res.ID.Kind {
+		case "Deployment", "StatefulSet", "ReplicaSet":
+			if n, ok := intField(res, "spec.replicas"); ok {
+				replicas = n
+			}
+		case "Job":
+			if n, ok := intField(res, "spec.parallelism"); ok {
+				replicas = n
+			}
+		case "CronJob":
+			if n, ok := intField(res, "spec.jobTemplate.spec.parallelism"); ok {
+				replicas = n
+			}
+		}
+		minReplicas, maxReplicas := replicas, replicas
+		if r, ok := autoscalers[autoscalerKey{res.ID.Namespace, res.ID.Kind, res.ID.Name}]; ok {
+			minReplicas, maxReplicas = r[0], r[1]
+		}
+		pod := podCapacity(podSpec)
+		capacities[res.ID.Namespace] = CapacityRange{
+			Min: capacities[res.ID.Namespace].Min.add(pod, minReplicas),
+			Max: capacities[res.ID.Namespace].Max.add(pod, maxReplicas),
+		}
+	}
+	return capacities
+}
+
+// CapacityDeltas compares the capacities by namespace.
+func CapacityDeltas(base, target []*Resource) []*CapacityDelta {
+	baseCapacities := CapacityByNamespace(base)
+	targetCapacities := CapacityByNamespace(target)
+	namespaces := make([]string, 0, len(baseCapacities)+len(targetCapacities))
+	for namespace := range baseCapacities {
+		namespaces = append(namespaces, namespace)
+	}
+	for namespace := range targetCapacities {
+		if _, ok := baseCapacities[namespace]; !ok {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	deltas := make([]*CapacityDelta, 0)
+	for _, namespace := range namespaces {
+		if baseCapacities[namespace] == targetCapacities[namespace] {
+			continue
+		}
+		deltas = append(deltas, &CapacityDelta{
+			Namespace: namespace,
+			Base:      baseCapacities[namespace],
+			Target:    targetCapacities[namespace],
+		})
+	}
+	return deltas
+}
+
+// podCapacity is the effective resources of a pod, where the init containers
+// run one by one before the containers.
+func podCapacity(podSpec interface{}) Capacity {
+	total := Capacity{}
+	containers, _ := lookupField(podSpec, "containers")
+	list, _ := containers.([]interface{})
+	for _, container := range list {
+		total = total.add(containerCapacity(container), 1)
+	}
+	initContainers, _ := lookupField(podSpec, "initContainers")
+	list, _ = initContainers.([]interface{})
+	for _, container := range list {
+		total = total.max(containerCapacity(container))
+	}
+	return total
+}
+
+func containerCapacity(container interface{}) Capacity {
+	quantity := func(path string, scale float64) int64 {
+		value, ok := lookupField(container, path)
+		if !ok {
+			return 0
+		}
+		q, err := ParseQuantity(fmt.Sprint(value))
+		if err != nil {
+			return 0
+		}
+		return int64(math.Ceil(q * scale))
+	}
+	return Capacity{
+		CPURequests:    quantity("resources.requests.cpu", 1000),
+		CPULimits:      quantity("resources.limits.cpu", 1000),
+		MemoryRequests: quantity("resources.requests.memory", 1),
+		MemoryLimits:   quantity("resources.limits.memory", 1),
+	}
+}
+
+func intField(res *Resource, path string) (int64, bool) {
+	value, ok := res.Field(path)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapacityDeltas(t *testing.T) {
+	deployment := func(replicas string, cpu string) string {
+		return `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: prod
+spec:
+  replicas: ` + replicas + `
+  template:
+    spec:
+      initContainers:
+      - name: init
+        resources:
+          requests:
+            cpu: "4"
+      containers:
+      - name: app
+        resources:
+          requests:
+            cpu: ` + cpu + `
+            memory: 1Gi
+          limits:
+            memory: 2Gi
+      - name: sidecar
+        resources:
+          requests:
+            cpu: 100m
+            memory: 128Mi
+`
+	}
+	hpa := `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: app
+  namespace: prod
+spec:
+  scaleTargetRef:
+    apiVersion: apps/v1
+    kind: Deployment
+    name: app
+  minReplicas: 2
+  maxReplicas: 10
+`
+	daemonSet := `apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: agent
+  namespace: system
+spec:
+  template:
+    spec:
+      containers:
+      - name: agent
+        resources:
+          requests:
+            cpu: 50m
+`
+	base, target := parseTestBuilds(t, deployment("3", "500m"), deployment("3", "1")+"---\n"+hpa+"---\n"+daemonSet)
+	gi := int64(1 << 30)
+	mi := int64(1 << 20)
+	assert.Equal(t, []*CapacityDelta{
+		{
+			Namespace: "prod",
+			Base: CapacityRange{
+				// The init container requests more CPU than the containers.
+				Min: Capacity{CPURequests: 12000, MemoryRequests: 3*gi + 3*128*mi, MemoryLimits: 6 * gi},
+				Max: Capacity{CPURequests: 12000, MemoryRequests: 3*gi + 3*128*mi, MemoryLimits: 6 * gi},
+			},
+			Target: CapacityRange{
+				Min: Capacity{CPURequests: 8000, MemoryRequests: 2*gi + 2*128*mi, MemoryLimits: 4 * gi},
+				Max: Capacity{CPURequests: 40000, MemoryRequests: 10*gi + 10*128*mi, MemoryLimits: 20 * gi},
+			},
+		},
+		{
+			Namespace: "system",
+			Target: CapacityRange{
+				Min: Capacity{CPURequests: 50},
+				Max: Capacity{CPURequests: 50},
+			},
+		},
+	}, CapacityDeltas(base, target))
+	assert.Empty(t, CapacityDeltas(base, base))
+}
+
+func TestCapacityDeltasByNamespace(t *testing.T) {
+	delta := func(cpu int64) *CapacityDelta {
+		return &CapacityDelta{Namespace: "prod", Target: CapacityRange{Min: Capacity{CPURequests: cpu}, Max: Capacity{CPURequests: cpu}}}
+	}
+	dm := NewDiffMap()
+	dm.CapacityDeltas["base"] = []*CapacityDelta{delta(100)}
+	dm.CapacityDeltas["overlay"] = []*CapacityDelta{delta(100)}
+	dm.CapacityDeltas["other"] = []*CapacityDelta{delta(50)}
+	dm.IncludedDirs["base"] = struct{}{}
+	assert.Equal(t, []*CapacityDelta{delta(150)}, dm.CapacityDeltasByNamespace())
+}
+
+func TestQuantity(t *testing.T) {
+	for s, expected := range map[string]float64{
+		"1":     1,
+		"500m":  0.5,
+		"1.5":   1.5,
+		"1Ki":   1024,
+		"2Gi":   2 * (1 << 30),
+		"1G":    1e9,
+		"100Mi": 100 * (1 << 20),
+	} {
+		value, err := ParseQuantity(s)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		assert.Equal(t, expected, value, s)
+	}
+	_, err := ParseQuantity("1X")
+	assert.Error(t, err)
+
+	assert.Equal(t, "12", FormatCPU(12000))
+	assert.Equal(t, "-500m", FormatCPU(-500))
+	assert.Equal(t, "1.5Gi", FormatMemory(3<<29))
+	assert.Equal(t, "-128Mi", FormatMemory(-128<<20))
+	assert.Equal(t, "100", FormatMemory(100))
+}
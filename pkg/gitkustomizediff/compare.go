@@ -0,0 +1,140 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type CompareOpts struct {
+	Ref                     string
+	KustomizePath           string
+	KustomizeLoadRestrictor string
+	CacheDir                string
+	GitPath                 string
+	Debug                   bool
+	IgnoreNamespace         bool
+	IgnoreNamePrefixes      []string
+	IgnoreNameSuffixes      []string
+	// RepoURL is used only with a ref as the working tree can't be linked.
+	RepoURL      string
+	RepoProvider RepoProvider
+}
+
+type OverlayComparison struct {
+	Base   string
+	Target string
+	Diffs  []*ResourceDiff
+	Err    error
+}
+
+type CompareResult struct {
+	Commit      string
+	Comparisons []*OverlayComparison
+	// Links is nil without a repo URL or a ref.
+	Links *RepoLinks
+}
+
+func CompareOverlays(dirPath string, overlays []string, opts CompareOpts) (*CompareResult, error) {
+	log.Info("Start compare")
+	if len(overlays) < 2 {
+		return nil, errors.Errorf("at least 2 overlays are required but got %d", len(overlays))
+	}
+	commit := ""
+	var links *RepoLinks
+	if opts.Ref != "" {
+		currentGitDir := utils.NewGitDir(dirPath, opts.GitPath)
+		var err error
+		commit, err = currentGitDir.CommitHash(opts.Ref)
+		if err != nil {
+			return nil, err
+		}
+		links, err = resolveRepoLinks(currentGitDir, opts.RepoURL, opts.RepoProvider, "")
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Clone the git repo at %s", commit)
+		tmpDirPath, err := ioutil.TempDir("", "git-kustomize-diff-compare-")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if opts.Debug {
+			log.Infof("Repo path: %s", tmpDirPath)
+		} else {
+			defer os.RemoveAll(tmpDirPath)
+		}
+		gitDir, err := currentGitDir.CloneAndCheckout(tmpDirPath, commit)
+		if err != nil {
+			return nil, err
+		}
+		dirPath = gitDir.WorkDir.Dir
+	}
+
+	buildOpts := BuildOpts{
+		KustomizePath:           opts.KustomizePath,
+		KustomizeLoadRestrictor: opts.KustomizeLoadRestrictor,
+		CacheDir:                opts.CacheDir,
+	}
+	builds := make([][]*Resource, len(overlays))
+	buildErrs := make([]error, len(overlays))
+	for i, overlay := range overlays {
+		log.Infof("Build %s", overlay)
+		text, err := Build(filepath.Join(dirPath, overlay), buildOpts)
+		if err != nil {
+			buildErrs[i] = err
+			continue
+		}
+		builds[i], buildErrs[i] = ParseResources(text)
+	}
+
+	diffOpts := ResourceDiffOpts{
+		IgnoreNamespace:    opts.IgnoreNamespace,
+		IgnoreNamePrefixes: opts.IgnoreNamePrefixes,
+		IgnoreNameSuffixes: opts.IgnoreNameSuffixes,
+	}
+	comparisons := make([]*OverlayComparison, 0)
+	for i := 0; i < len(overlays); i++ {
+		for j := i + 1; j < len(overlays); j++ {
+			comparison := &OverlayComparison{
+				Base:   overlays[i],
+				Target: overlays[j],
+			}
+			comparisons = append(comparisons, comparison)
+			if buildErrs[i] != nil {
+				comparison.Err = buildErrs[i]
+				continue
+			}
+			if buildErrs[j] != nil {
+				comparison.Err = buildErrs[j]
+				continue
+			}
+			comparison.Diffs, comparison.Err = DiffResources(builds[i], builds[j], diffOpts)
+		}
+	}
+
+	return &CompareResult{
+		Commit:      commit,
+		Comparisons: comparisons,
+		Links:       links,
+	}, nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareOverlays(t *testing.T) {
+	wd, _ := os.Getwd()
+
+	expectedDeploymentDiff := strings.TrimLeft(`
+@@ -3,7 +3,7 @@
+ metadata:
+   name: app
+ spec:
+-  replicas: 1
++  replicas: 3
+   template:
+     spec:
+       containers:
+`, "\n")
+
+	dirPath := filepath.Join(wd, "fixtures", "compare")
+	res, err := CompareOverlays(dirPath, []string{"stg", "prod"}, CompareOpts{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 1, len(res.Comparisons))
+	assert.NoError(t, res.Comparisons[0].Err)
+	ids := []string{}
+	for _, diff := range res.Comparisons[0].Diffs {
+		ids = append(ids, diff.ID.String())
+	}
+	assert.Equal(t, []string{
+		"Deployment.apps/prod/prod-app",
+		"Deployment.apps/stg/stg-app",
+		"PodDisruptionBudget.policy/prod/prod-app",
+		"Service/prod/prod-app",
+		"Service/stg/stg-app",
+	}, ids)
+
+	res, err = CompareOverlays(dirPath, []string{"stg", "prod"}, CompareOpts{
+		IgnoreNamespace:    true,
+		IgnoreNamePrefixes: []string{"stg-", "prod-"},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	diffs := res.Comparisons[0].Diffs
+	if !assert.Equal(t, 2, len(diffs)) {
+		t.FailNow()
+	}
+	assert.Equal(t, "Deployment.apps/app", diffs[0].ID.String())
+	assert.Equal(t, ResourceChanged, diffs[0].Type)
+	assert.Equal(t, expectedDeploymentDiff, diffs[0].Content)
+	assert.Equal(t, "PodDisruptionBudget.policy/app", diffs[1].ID.String())
+	assert.Equal(t, ResourceAdded, diffs[1].Type)
+
+	res, err = CompareOverlays(dirPath, []string{"base", "stg", "prod"}, CompareOpts{
+		IgnoreNamespace:    true,
+		IgnoreNamePrefixes: []string{"stg-", "prod-"},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 3, len(res.Comparisons))
+	assert.Equal(t, 0, len(res.Comparisons[0].Diffs))
+	assert.Equal(t, "base", res.Comparisons[1].Base)
+	assert.Equal(t, "prod", res.Comparisons[1].Target)
+	assert.Equal(t, 2, len(res.Comparisons[1].Diffs))
+
+	_, err = CompareOverlays(dirPath, []string{"stg"}, CompareOpts{})
+	assert.Error(t, err)
+}
+
+func TestDiffResourcesCollision(t *testing.T) {
+	resources, err := ParseResources(`apiVersion: v1
+kind: Service
+metadata:
+  name: stg-app
+  namespace: stg
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: prod
+`)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = DiffResources(resources, resources, ResourceDiffOpts{IgnoreNamespace: true})
+	assert.NoError(t, err)
+	_, err = DiffResources(resources, resources, ResourceDiffOpts{IgnoreNamespace: true, IgnoreNamePrefixes: []string{"stg-"}})
+	assert.EqualError(t, err, "Service/stg/stg-app and Service/prod/app collide as Service/app after ignoring the namespaces and the name affixes")
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+)
+
+// DeprecatedAPI is an API version of a kind deprecated and removed in the
+// minor versions of Kubernetes 1.x. Replacement is empty if the kind is
+// removed without a replacement.
+type DeprecatedAPI struct {
+	APIVersion   string
+	Kind         string
+	DeprecatedIn int
+	RemovedIn    int
+	Replacement  string
+}
+
+// deprecatedAPIs is based on the Kubernetes deprecated API migration guide.
+var deprecatedAPIs = func() []*DeprecatedAPI {
+	apis := make([]*DeprecatedAPI, 0)
+	add := func(apiVersion string, kinds []string, deprecatedIn, removedIn int, replacement string) {
+		for _, kind := range kinds {
+			apis = append(apis, &DeprecatedAPI{apiVersion, kind, deprecatedIn, removedIn, replacement})
+		}
+	}
+	workloads := []string{"Deployment", "StatefulSet", "DaemonSet", "ReplicaSet"}
+	add("extensions/v1beta1", []string{"Deployment", "DaemonSet", "ReplicaSet"}, 9, 16, "apps/v1")
+	add("extensions/v1beta1", []string{"NetworkPolicy"}, 9, 16, "networking.k8s.io/v1")
+	add("extensions/v1beta1", []string{"PodSecurityPolicy"}, 10, 16, "policy/v1beta1")
+	add("apps/v1beta1", workloads, 9, 16, "apps/v1")
+	add("apps/v1beta2", workloads, 9, 16, "apps/v1")
+	add("admissionregistration.k8s.io/v1beta1", []string{"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"}, 16, 22, "admissionregistration.k8s.io/v1")
+	add("apiextensions.k8s.io/v1beta1", []string{"CustomResourceDefinition"}, 16, 22, "apiextensions.k8s.io/v1")
+	add("apiregistration.k8s.io/v1beta1", []string{"APIService"}, 19, 22, "apiregistration.k8s.io/v1")
+	add("authentication.k8s.io/v1beta1", []string{"TokenReview"}, 19, 22, "authentication.k8s.io/v1")
+	add("authorization.k8s.io/v1beta1", []string{"LocalSubjectAccessReview", "SelfSubjectAccessReview", "SubjectAccessReview"}, 19, 22, "authorization.k8s.io/v1")
+	add("certificates.k8s.io/v1beta1", []string{"CertificateSigningRequest"}, 19, 22, "certificates.k8s.io/v1")
+	add("coordination.k8s.io/v1beta1", []string{"Lease"}, 19, 22, "coordination.k8s.io/v1")
+	add("extensions/v1beta1", []string{"Ingress"}, 14, 22, "networking.k8s.io/v1")
+	add("networking.k8s.io/v1beta1", []string{"Ingress", "IngressClass"}, 19, 22, "networking.k8s.io/v1")
+	add("rbac.authorization.k8s.io/v1beta1", []string{"ClusterRole", "ClusterRoleBinding", "Role", "RoleBinding"}, 17, 22, "rbac.authorization.k8s.io/v1")
+	add("scheduling.k8s.io/v1beta1", []string{"PriorityClass"}, 14, 22, "scheduling.k8s.io/v1")
+	add("storage.k8s.io/v1beta1", []string{"CSIDriver", "CSINode", "StorageClass", "VolumeAttachment"}, 19, 22, "storage.k8s.io/v1")
+	add("batch/v1beta1", []string{"CronJob"}, 21, 25, "batch/v1")
+	add("discovery.k8s.io/v1beta1", []string{"EndpointSlice"}, 21, 25, "discovery.k8s.io/v1")
+	add("events.k8s.io/v1beta1", []string{"Event"}, 19, 25, "events.k8s.io/v1")
+	add("autoscaling/v2beta1", []string{"HorizontalPodAutoscaler"}, 22, 25, "autoscaling/v2")
+	add("policy/v1beta1", []string{"PodDisruptionBudget"}, 21, 25, "policy/v1")
+	add("policy/v1beta1", []string{"PodSecurityPolicy"}, 21, 25, "")
+	add("node.k8s.io/v1beta1", []string{"RuntimeClass"}, 20, 25, "node.k8s.io/v1")
+	add("autoscaling/v2beta2", []string{"HorizontalPodAutoscaler"}, 23, 26, "autoscaling/v2")
+	add("flowcontrol.apiserver.k8s.io/v1beta1", []string{"FlowSchema", "PriorityLevelConfiguration"}, 23, 26, "flowcontrol.apiserver.k8s.io/v1")
+	add("storage.k8s.io/v1beta1", []string{"CSIStorageCapacity"}, 24, 27, "storage.k8s.io/v1")
+	add("flowcontrol.apiserver.k8s.io/v1beta2", []string{"FlowSchema", "PriorityLevelConfiguration"}, 26, 29, "flowcontrol.apiserver.k8s.io/v1")
+	add("flowcontrol.apiserver.k8s.io/v1beta3", []string{"FlowSchema", "PriorityLevelConfiguration"}, 29, 32, "flowcontrol.apiserver.k8s.io/v1")
+	return apis
+}()
+
+// DeprecationAnalyzer flags the resources whose API versions are deprecated
+// or removed in the Kubernetes version.
+type DeprecationAnalyzer struct {
+	minor int
+}
+
+// NewDeprecationAnalyzer checks the APIs in the Kubernetes version such as
+// 1.25, which defaults to the latest version removing an API.
+func NewDeprecationAnalyzer(kubeVersion string) (*DeprecationAnalyzer, error) {
+	if kubeVersion == "" {
+		minor := 0
+		for _, api := range deprecatedAPIs {
+			if api.RemovedIn > minor {
+				minor = api.RemovedIn
+			}
+		}
+		return &DeprecationAnalyzer{minor: minor}, nil
+	}
+	minor, err := parseKubeMinorVersion(kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &DeprecationAnalyzer{minor: minor}, nil
+}
+
+func (a *DeprecationAnalyzer) Name() string {
+	return "deprecation"
+}
+
+func (a *DeprecationAnalyzer) Title() string {
+	return "Deprecated APIs"
+}
+
+func (a *DeprecationAnalyzer) Analyze(base, target []*Resource) ([]*Finding, error) {
+	apis := map[[2]string]*DeprecatedAPI{}
+	for _, api := range deprecatedAPIs {
+		apis[[2]string{api.APIVersion, api.Kind}] = api
+	}
+	baseMap := resourceMap(base)
+	findings := make([]*Finding, 0)
+	for _, res := range target {
+		api, ok := apis[[2]string{res.APIVersion, res.ID.Kind}]
+		if !ok || a.minor < api.DeprecatedIn {
+			continue
+		}
+		finding := &Finding{ID: res.ID}
+		if a.minor >= api.RemovedIn {
+			finding.Severity = SeverityHigh
+			finding.Message = fmt.Sprintf("`%s` is removed in Kubernetes 1.%d", api.APIVersion, api.RemovedIn)
+		} else {
+			finding.Severity = SeverityMedium
+			finding.Message = fmt.Sprintf("`%s` is deprecated since Kubernetes 1.%d and removed in 1.%d", api.APIVersion, api.DeprecatedIn, api.RemovedIn)
+		}
+		if api.Replacement != "" {
+			finding.Message += fmt.Sprintf(", use `%s`", api.Replacement)
+		} else {
+			finding.Message += " without a replacement"
+		}
+		if baseRes, ok := baseMap[res.ID]; ok && baseRes.APIVersion == res.APIVersion {
+			finding.Existing = true
+		}
+		findings = append(findings, finding)
+	}
+	return findings, nil
+}
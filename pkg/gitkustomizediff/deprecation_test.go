@@ -0,0 +1,95 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeprecationAnalyzer(t *testing.T) {
+	base, err := ParseResources(`apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: app
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: app
+`)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	target, err := ParseResources(`apiVersion: policy/v1beta1
+kind: PodDisruptionBudget
+metadata:
+  name: app
+---
+apiVersion: autoscaling/v2beta2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: app
+---
+apiVersion: policy/v1beta1
+kind: PodSecurityPolicy
+metadata:
+  name: restricted
+`)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	analyzer, err := NewDeprecationAnalyzer("v1.24.3")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	findings := analyzeTestBuilds(t, analyzer, base, target)
+	assert.Equal(t, []*Finding{
+		{Severity: SeverityMedium, ID: target[0].ID, Message: "`policy/v1beta1` is deprecated since Kubernetes 1.21 and removed in 1.25, use `policy/v1`", Existing: true},
+		{Severity: SeverityMedium, ID: target[1].ID, Message: "`autoscaling/v2beta2` is deprecated since Kubernetes 1.23 and removed in 1.26, use `autoscaling/v2`"},
+		{Severity: SeverityMedium, ID: target[2].ID, Message: "`policy/v1beta1` is deprecated since Kubernetes 1.21 and removed in 1.25 without a replacement"},
+	}, findings)
+
+	analyzer, err = NewDeprecationAnalyzer("")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	findings = analyzeTestBuilds(t, analyzer, base, target)
+	if !assert.Len(t, findings, 3) {
+		t.FailNow()
+	}
+	assert.Equal(t, SeverityHigh, findings[1].Severity)
+	assert.Equal(t, "`autoscaling/v2beta2` is removed in Kubernetes 1.26, use `autoscaling/v2`", findings[1].Message)
+
+	analyzer, err = NewDeprecationAnalyzer("1.20")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	findings = analyzeTestBuilds(t, analyzer, base, target)
+	assert.Empty(t, findings)
+
+	_, err = NewDeprecationAnalyzer("2.0")
+	assert.Error(t, err)
+}
+
+func TestHasFindingsExisting(t *testing.T) {
+	dm := NewDiffMap()
+	dm.Findings["a"] = []*Finding{{Severity: SeverityHigh, Existing: true}, {Severity: SeverityLow}}
+	assert.False(t, dm.HasFindings(SeverityHigh))
+	assert.True(t, dm.HasFindings(SeverityLow))
+}
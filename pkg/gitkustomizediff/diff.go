@@ -19,6 +19,7 @@ package gitkustomizediff
 import (
 	"path/filepath"
 	"regexp"
+	"sort"
 
 	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
 	"github.com/pkg/errors"
@@ -33,20 +34,38 @@ type DiffOpts struct {
 	ExcludeRegexp           *regexp.Regexp
 	KustomizePath           string
 	KustomizeLoadRestrictor string
+	CacheDir                string
+	SkipUnchanged           bool
+	// Origins resolves the changed resources to their source files.
+	Origins bool
+	// PathPrefix is the repo-relative path of the dirs, which is prepended to
+	// the source files.
+	PathPrefix string
+	Analyzers  []Analyzer
+	// Images lists the image changes if given.
+	Images   *ImageInventory
+	Capacity bool
 }
 
 func Diff(baseDirPath, targetDirPath string, opts DiffOpts) (*DiffMap, error) {
+	fSys := filesys.MakeFsOnDisk()
+	return DiffFs(fSys, baseDirPath, fSys, targetDirPath, opts)
+}
+
+// DiffFs is the same as Diff except that the base and target dirs are read
+// from the given file systems.
+func DiffFs(baseFs filesys.FileSystem, baseDirPath string, targetFs filesys.FileSystem, targetDirPath string, opts DiffOpts) (*DiffMap, error) {
 	log.Info("Start diff")
 	listOpts := utils.ListKustomizeDirsOpts{
 		IncludeRegexp: opts.IncludeRegexp,
 		ExcludeRegexp: opts.ExcludeRegexp,
 	}
-	baseKDirs, err := utils.ListKustomizeDirs(baseDirPath, listOpts)
+	baseKDirs, err := utils.ListKustomizeDirsInFs(baseFs, baseDirPath, listOpts)
 	if err != nil {
 		return nil, err
 	}
 	log.Debugf("base dirs: %+v", baseKDirs)
-	targetKDirs, err := utils.ListKustomizeDirs(targetDirPath, listOpts)
+	targetKDirs, err := utils.ListKustomizeDirsInFs(targetFs, targetDirPath, listOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -55,43 +74,235 @@ func Diff(baseDirPath, targetDirPath string, opts DiffOpts) (*DiffMap, error) {
 	for _, kDir := range append(baseKDirs, targetKDirs...) {
 		kDirs[kDir] = struct{}{}
 	}
+	baseBuildOpts := BuildOpts{
+		KustomizePath:           opts.KustomizePath,
+		KustomizeLoadRestrictor: opts.KustomizeLoadRestrictor,
+		CacheDir:                opts.CacheDir,
+		Origins:                 opts.Origins,
+		FileSystem:              baseFs,
+	}
+	targetBuildOpts := baseBuildOpts
+	targetBuildOpts.FileSystem = targetFs
 	diffMap := NewDiffMap()
+	if opts.Capacity {
+		for kDir := range includedDirs(baseFs, baseDirPath, kDirs) {
+			diffMap.IncludedDirs[kDir] = struct{}{}
+		}
+		for kDir := range includedDirs(targetFs, targetDirPath, kDirs) {
+			diffMap.IncludedDirs[kDir] = struct{}{}
+		}
+	}
 	for kDir := range kDirs {
 		baseKDirPath := filepath.Join(baseDirPath, kDir)
-		if !utils.KustomizationExists(baseKDirPath) {
-			err := utils.MakeKustomizeDir(baseKDirPath)
+		baseExists := utils.KustomizationExistsInFs(baseFs, baseKDirPath)
+		targetKDirPath := filepath.Join(targetDirPath, kDir)
+		targetExists := utils.KustomizationExistsInFs(targetFs, targetKDirPath)
+		if targetExists {
+			if kustomizationPath, err := utils.KustomizationFilePath(targetFs, targetKDirPath); err == nil {
+				diffMap.KustomizationFiles[kDir] = filepath.Base(kustomizationPath)
+			}
+		}
+		if opts.SkipUnchanged && baseExists && targetExists {
+			unchanged, remote, err := sameInputs(baseFs, baseKDirPath, targetFs, targetKDirPath)
+			if err != nil {
+				log.Debugf("Failed to compare the inputs of %s: %+v", kDir, err)
+			}
+			if len(remote) > 0 {
+				diffMap.RemoteInputs[kDir] = remote
+			}
+			if unchanged {
+				log.Debugf("Skip building %s as the inputs are identical", kDir)
+				diffMap.Results[kDir] = &DiffUnchanged{}
+				continue
+			}
+		}
+		// A kustomization missing on one side is regarded as an empty build.
+		baseYaml := ""
+		if baseExists {
+			baseYaml, err = Build(baseKDirPath, baseBuildOpts)
 			if err != nil {
 				diffMap.Results[kDir] = &DiffError{err}
 				continue
 			}
 		}
-		targetKDirPath := filepath.Join(targetDirPath, kDir)
-		if !utils.KustomizationExists(targetKDirPath) {
-			err := utils.MakeKustomizeDir(targetKDirPath)
+		targetYaml := ""
+		if targetExists {
+			targetYaml, err = Build(targetKDirPath, targetBuildOpts)
 			if err != nil {
 				diffMap.Results[kDir] = &DiffError{err}
 				continue
 			}
 		}
-		baseYaml, err := Build(baseKDirPath, BuildOpts{opts.KustomizePath, opts.KustomizeLoadRestrictor})
+
+		var baseOrigins, targetOrigins map[ResourceID]string
+		if opts.Origins {
+			baseYaml, baseOrigins, err = stripOrigins(baseYaml)
+			if err != nil {
+				diffMap.Results[kDir] = &DiffError{err}
+				continue
+			}
+			targetYaml, targetOrigins, err = stripOrigins(targetYaml)
+			if err != nil {
+				diffMap.Results[kDir] = &DiffError{err}
+				continue
+			}
+		}
+
+		content, err := utils.Diff(baseYaml, targetYaml)
 		if err != nil {
 			diffMap.Results[kDir] = &DiffError{err}
 			continue
 		}
-		targetYaml, err := Build(targetKDirPath, BuildOpts{opts.KustomizePath, opts.KustomizeLoadRestrictor})
+		result := &DiffContent{content: content}
+		if opts.Origins && content != "" {
+			baseSources, err := newOriginSources(baseFs, baseDirPath, kDir, opts.PathPrefix, baseOrigins, baseExists)
+			if err != nil {
+				diffMap.Results[kDir] = &DiffError{err}
+				continue
+			}
+			targetSources, err := newOriginSources(targetFs, targetDirPath, kDir, opts.PathPrefix, targetOrigins, targetExists)
+			if err != nil {
+				diffMap.Results[kDir] = &DiffError{err}
+				continue
+			}
+			result.Sources, err = resourceSources(baseYaml, targetYaml, baseSources, targetSources)
+			if err != nil {
+				diffMap.Results[kDir] = &DiffError{err}
+				continue
+			}
+		}
+		diffMap.Results[kDir] = result
+		if len(opts.Analyzers) > 0 || opts.Images != nil || opts.Capacity {
+			baseResources, targetResources, err := parseBuilds(baseYaml, targetYaml)
+			if err != nil {
+				// The diff is kept even if the builds can't be inspected.
+				log.Warnf("failed to parse the builds of %s: %v", kDir, err)
+				for _, analyzer := range opts.Analyzers {
+					diffMap.AnalyzerErrors[kDir] = append(diffMap.AnalyzerErrors[kDir], &AnalyzerError{Analyzer: analyzer.Name(), Dir: kDir, Err: err})
+				}
+				continue
+			}
+			diffMap.inspect(opts, kDir, baseResources, targetResources)
+		}
+	}
+	return diffMap, nil
+}
+
+func parseBuilds(baseYaml, targetYaml string) ([]*Resource, []*Resource, error) {
+	baseResources, err := ParseResources(baseYaml)
+	if err != nil {
+		return nil, nil, err
+	}
+	targetResources, err := ParseResources(targetYaml)
+	if err != nil {
+		return nil, nil, err
+	}
+	return baseResources, targetResources, nil
+}
+
+// inspect runs the analyzers and collects the image and capacity changes.
+func (dm *DiffMap) inspect(opts DiffOpts, kDir string, baseResources, targetResources []*Resource) {
+	findings, analyzerErrors := analyze(opts.Analyzers, kDir, baseResources, targetResources)
+	if len(findings) > 0 {
+		dm.Findings[kDir] = findings
+	}
+	if len(analyzerErrors) > 0 {
+		dm.AnalyzerErrors[kDir] = analyzerErrors
+	}
+	if opts.Images != nil {
+		if changes := opts.Images.Changes(baseResources, targetResources); len(changes) > 0 {
+			dm.ImageChanges[kDir] = changes
+		}
+	}
+	if opts.Capacity {
+		if deltas := CapacityDeltas(baseResources, targetResources); len(deltas) > 0 {
+			dm.CapacityDeltas[kDir] = deltas
+		}
+	}
+}
+
+// includedDirs lists the dirs of the kustomizations included by the other
+// ones in the dirs.
+func includedDirs(fSys filesys.FileSystem, dirPath string, kDirs map[string]struct{}) map[string]struct{} {
+	included := map[string]struct{}{}
+	for kDir := range kDirs {
+		kDirPath := filepath.Join(dirPath, kDir)
+		if !utils.KustomizationExistsInFs(fSys, kDirPath) {
+			continue
+		}
+		inputs, err := utils.ListKustomizationInputs(fSys, kDirPath)
 		if err != nil {
-			diffMap.Results[kDir] = &DiffError{err}
+			log.Debugf("Failed to list the inputs of %s: %+v", kDir, err)
 			continue
 		}
+		for _, file := range inputs.Files {
+			dir, err := filepath.Rel(dirPath, filepath.Dir(file))
+			if err != nil || dir == kDir {
+				continue
+			}
+			if _, ok := kDirs[dir]; !ok {
+				continue
+			}
+			if kustomizationPath, err := utils.KustomizationFilePath(fSys, filepath.Dir(file)); err == nil && kustomizationPath == file {
+				included[dir] = struct{}{}
+			}
+		}
+	}
+	return included
+}
 
-		content, err := utils.Diff(baseYaml, targetYaml)
+// sameInputs compares the git blob hashes of the input files of the
+// kustomizations. Kustomizations with remote inputs are never regarded as
+// the same and the remote inputs are returned.
+func sameInputs(baseFs filesys.FileSystem, baseKDirPath string, targetFs filesys.FileSystem, targetKDirPath string) (bool, []string, error) {
+	baseInputs, err := utils.ListKustomizationInputs(baseFs, baseKDirPath)
+	if err != nil {
+		return false, nil, err
+	}
+	targetInputs, err := utils.ListKustomizationInputs(targetFs, targetKDirPath)
+	if err != nil {
+		return false, nil, err
+	}
+	remote := map[string]struct{}{}
+	for _, r := range append(baseInputs.Remote, targetInputs.Remote...) {
+		remote[r] = struct{}{}
+	}
+	if len(remote) > 0 {
+		remoteList := make([]string, 0, len(remote))
+		for r := range remote {
+			remoteList = append(remoteList, r)
+		}
+		sort.Strings(remoteList)
+		return false, remoteList, nil
+	}
+	if len(baseInputs.Files) != len(targetInputs.Files) {
+		return false, nil, nil
+	}
+	for i := range baseInputs.Files {
+		baseRelPath, err := filepath.Rel(baseKDirPath, baseInputs.Files[i])
 		if err != nil {
-			diffMap.Results[kDir] = &DiffError{err}
-			continue
+			return false, nil, errors.WithStack(err)
+		}
+		targetRelPath, err := filepath.Rel(targetKDirPath, targetInputs.Files[i])
+		if err != nil {
+			return false, nil, errors.WithStack(err)
+		}
+		if baseRelPath != targetRelPath {
+			return false, nil, nil
+		}
+		baseHash, err := utils.BlobHash(baseFs, baseInputs.Files[i])
+		if err != nil {
+			return false, nil, err
+		}
+		targetHash, err := utils.BlobHash(targetFs, targetInputs.Files[i])
+		if err != nil {
+			return false, nil, err
+		}
+		if baseHash != targetHash {
+			return false, nil, nil
 		}
-		diffMap.Results[kDir] = &DiffContent{content}
 	}
-	return diffMap, nil
+	return true, nil, nil
 }
 
 func MakeBuildOptions(kustomizeLoadRestrictor string) (*krusty.Options, error) {
@@ -125,12 +336,63 @@ func MakeBuildOptions(kustomizeLoadRestrictor string) (*krusty.Options, error) {
 type BuildOpts struct {
 	KustomizePath           string
 	KustomizeLoadRestrictor string
+	CacheDir                string
+	// Origins annotates the resources with the files they originate from.
+	Origins bool
+	// FileSystem is the file system to build from (default to the disk).
+	FileSystem filesys.FileSystem
+}
+
+func (opts BuildOpts) fileSystem() filesys.FileSystem {
+	if opts.FileSystem == nil {
+		return filesys.MakeFsOnDisk()
+	}
+	return opts.FileSystem
 }
 
 func Build(dirPath string, opts BuildOpts) (string, error) {
+	if opts.CacheDir == "" {
+		return build(dirPath, opts)
+	}
+	cache := NewBuildCache(opts.CacheDir)
+	key, err := cache.Key(dirPath, opts)
+	if err != nil {
+		// Let the build report the problem if the inputs are broken.
+		log.Debugf("Failed to compute the build cache key of %s: %+v", dirPath, err)
+		return build(dirPath, opts)
+	}
+	if key == "" {
+		return build(dirPath, opts)
+	}
+	content, ok, err := cache.Get(key)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		log.Debugf("Use the build cache %s for %s", key, dirPath)
+		return content, nil
+	}
+	content, err = build(dirPath, opts)
+	if err != nil {
+		return "", err
+	}
+	err = cache.Put(key, content)
+	if err != nil {
+		return "", err
+	}
+	return content, nil
+}
+
+func build(dirPath string, opts BuildOpts) (string, error) {
 	if opts.KustomizePath != "" {
-		buildArgs := []string {"build"}
-		if (opts.KustomizeLoadRestrictor != "") {
+		if opts.Origins {
+			return "", errors.New("origins are not available with a kustomize binary")
+		}
+		if _, ok := opts.FileSystem.(*utils.GitFs); ok {
+			return "", errors.New("a kustomize binary can't build from git objects")
+		}
+		buildArgs := []string{"build"}
+		if opts.KustomizeLoadRestrictor != "" {
 			buildArgs = append(buildArgs, "--load-restrictor")
 			buildArgs = append(buildArgs, opts.KustomizeLoadRestrictor)
 		}
@@ -148,7 +410,13 @@ func Build(dirPath string, opts BuildOpts) (string, error) {
 	k := krusty.MakeKustomizer(
 		options,
 	)
-	fSys := filesys.MakeFsOnDisk()
+	fSys := opts.fileSystem()
+	if opts.Origins {
+		fSys, err = newOriginFs(fSys, dirPath)
+		if err != nil {
+			return "", err
+		}
+	}
 	resMap, err := k.Run(fSys, dirPath)
 	if err != nil {
 		return "", errors.WithStack(err)
@@ -102,7 +102,7 @@ spec:
 	_, err := Build(fixturesDirPath, BuildOpts{})
 	assert.NotEqual(t, err, nil)
 
-	buildOpts := BuildOpts{"", "LoadRestrictionsNone"}
+	buildOpts := BuildOpts{KustomizeLoadRestrictor: "LoadRestrictionsNone"}
 	actualYaml, err := Build(fixturesDirPath, buildOpts)
 	if !assert.NoError(t, err) {
 		t.FailNow()
@@ -156,7 +156,7 @@ func TestDiffLoadRestrictionsNone(t *testing.T) {
 		t.FailNow()
 	}
 
-	diffOpts := DiffOpts{nil, nil, "", "LoadRestrictionsNone"}
+	diffOpts := DiffOpts{KustomizeLoadRestrictor: "LoadRestrictionsNone"}
 	diffMap, err := Diff(baseDirPath, targetDirPath, diffOpts)
 	if !assert.NoError(t, err) {
 		t.FailNow()
@@ -164,3 +164,74 @@ func TestDiffLoadRestrictionsNone(t *testing.T) {
 	assert.Equal(t, 1, len(diffMap.Results))
 	assert.Equal(t, expectedSub1Diff, diffMap.Results["sub1/nested"].(*DiffContent).ToString())
 }
+
+func TestDiffSkipUnchanged(t *testing.T) {
+	wd, _ := os.Getwd()
+
+	baseDirPath := filepath.Join(wd, "fixtures", "diff", "base")
+	targetDirPath := filepath.Join(wd, "fixtures", "diff", "target")
+	diffMap, err := Diff(baseDirPath, targetDirPath, DiffOpts{SkipUnchanged: true})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 3, len(diffMap.Results))
+	assert.IsType(t, &DiffContent{}, diffMap.Results["sub1"])
+	assert.IsType(t, &DiffUnchanged{}, diffMap.Results["sub2"])
+	assert.IsType(t, &DiffError{}, diffMap.Results["invalid"])
+	// The missing local resource is reported as a build error.
+	assert.Empty(t, diffMap.RemoteInputs)
+	assert.Equal(t, []string{"invalid", "sub1"}, diffMap.ChangedDirs())
+}
+
+func TestDiffOrigins(t *testing.T) {
+	wd, _ := os.Getwd()
+
+	baseDirPath := filepath.Join(wd, "fixtures", "diff-origins", "base")
+	targetDirPath := filepath.Join(wd, "fixtures", "diff-origins", "target")
+	expectedDiffMap, err := Diff(baseDirPath, targetDirPath, DiffOpts{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	diffMap, err := Diff(baseDirPath, targetDirPath, DiffOpts{Origins: true, PathPrefix: "deploy"})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 2, len(diffMap.Results))
+	assert.Equal(t, "", diffMap.Results["base"].ToString())
+	assert.Empty(t, diffMap.Results["base"].(*DiffContent).Sources)
+	// The origin annotations are not shown in the diff.
+	assert.Equal(t, expectedDiffMap.Results["overlay"].ToString(), diffMap.Results["overlay"].ToString())
+	assert.Equal(t, []*ResourceSource{
+		{
+			ID:    ResourceID{Group: "apps", Kind: "Deployment", Name: "prod-app"},
+			Type:  ResourceChanged,
+			Files: []string{"deploy/base/deployment.yaml", "deploy/overlay/replicas.yaml"},
+		},
+		{
+			ID:    ResourceID{Kind: "Service", Name: "prod-app"},
+			Type:  ResourceAdded,
+			Files: []string{"deploy/overlay/service.yaml"},
+		},
+	}, diffMap.Results["overlay"].(*DiffContent).Sources)
+
+	_, err = Build(filepath.Join(targetDirPath, "overlay"), BuildOpts{KustomizePath: "kustomize", Origins: true})
+	assert.Error(t, err)
+}
+
+func TestDiffIncludedDirs(t *testing.T) {
+	wd, _ := os.Getwd()
+
+	baseDirPath := filepath.Join(wd, "fixtures", "diff-origins", "base")
+	targetDirPath := filepath.Join(wd, "fixtures", "diff-origins", "target")
+	diffMap, err := Diff(baseDirPath, targetDirPath, DiffOpts{Capacity: true})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, map[string]struct{}{"base": {}}, diffMap.IncludedDirs)
+
+	diffMap, err = Diff(baseDirPath, targetDirPath, DiffOpts{Capacity: true, ExcludeRegexp: regexp.MustCompile("overlay")})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Empty(t, diffMap.IncludedDirs)
+}
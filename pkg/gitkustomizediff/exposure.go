@@ -0,0 +1,299 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// exposedServiceTypes are the service types reachable from outside of the
+// cluster.
+var exposedServiceTypes = map[string]Severity{
+	"LoadBalancer": SeverityHigh,
+	"NodePort":     SeverityMedium,
+}
+
+// ExposureAnalyzer flags the changes which expose workloads to more clients.
+type ExposureAnalyzer struct{}
+
+func (a *ExposureAnalyzer) Name() string {
+	return "exposure"
+}
+
+func (a *ExposureAnalyzer) Title() string {
+	return "Network Exposure Changes"
+}
+
+func (a *ExposureAnalyzer) Analyze(base, target []*Resource) ([]*Finding, error) {
+	baseMap := resourceMap(base)
+	findings := make([]*Finding, 0)
+	for _, targetRes := range target {
+		// baseRes is nil for the new resources.
+		baseRes := baseMap[targetRes.ID]
+		var messages []findingMessage
+		switch targetRes.ID.Kind {
+		case "Service":
+			messages = serviceExposure(baseRes, targetRes)
+		case "Ingress":
+			messages = routeExposure(ingressRoutes(baseRes), ingressRoutes(targetRes))
+		case "HTTPRoute":
+			messages = routeExposure(httpRouteRoutes(baseRes), httpRouteRoutes(targetRes))
+		case "Gateway":
+			messages = gatewayExposure(baseRes, targetRes)
+		case "NetworkPolicy":
+			if baseRes != nil {
+				messages = networkPolicyExposure(baseRes, targetRes)
+			}
+		default:
+			if path, ok := podSpecPaths[targetRes.ID.Kind]; ok {
+				messages = hostExposure(baseRes, targetRes, path)
+			}
+		}
+		for _, message := range messages {
+			findings = append(findings, &Finding{Severity: message.severity, ID: targetRes.ID, Message: message.text})
+		}
+	}
+	targetMap := resourceMap(target)
+	for _, baseRes := range base {
+		if _, ok := targetMap[baseRes.ID]; !ok && baseRes.ID.Kind == "NetworkPolicy" {
+			findings = append(findings, &Finding{
+				Severity: SeverityHigh,
+				ID:       baseRes.ID,
+				Message:  "NetworkPolicy is deleted",
+			})
+		}
+	}
+	return findings, nil
+}
+
+type findingMessage struct {
+	severity Severity
+	text     string
+}
+
+func serviceExposure(base, target *Resource) []findingMessage {
+	messages := make([]findingMessage, 0)
+	serviceType := optionalFieldString(target, "spec.type")
+	if severity, ok := exposedServiceTypes[serviceType]; ok && optionalFieldString(base, "spec.type") != serviceType {
+		messages = append(messages, findingMessage{severity, fmt.Sprintf("type is %s `%s`", changedOrNew(base), serviceType)})
+	}
+	for _, ip := range newStrings(base, target, "spec.externalIPs") {
+		messages = append(messages, findingMessage{SeverityHigh, fmt.Sprintf("external IP `%s` is added", ip)})
+	}
+	if base != nil && len(fieldList(base, "spec.loadBalancerSourceRanges")) > 0 && len(fieldList(target, "spec.loadBalancerSourceRanges")) == 0 {
+		messages = append(messages, findingMessage{SeverityHigh, "load balancer source ranges are removed"})
+	} else {
+		for _, sourceRange := range newStrings(base, target, "spec.loadBalancerSourceRanges") {
+			messages = append(messages, findingMessage{SeverityMedium, fmt.Sprintf("load balancer source range `%s` is added", sourceRange)})
+		}
+	}
+	return messages
+}
+
+// ingressRoutes lists the hosts and paths of an Ingress. The empty host
+// matches any host.
+func ingressRoutes(res *Resource) []string {
+	if res == nil {
+		return nil
+	}
+	routes := make([]string, 0)
+	if _, ok := res.Field("spec.defaultBackend"); ok {
+		routes = append(routes, "*/*")
+	}
+	for _, rule := range fieldList(res, "spec.rules") {
+		host := stringOr(rule, "host", "*")
+		paths, _ := lookupField(rule, "http.paths")
+		list, _ := paths.([]interface{})
+		for _, path := range list {
+			routes = append(routes, host+stringOr(path, "path", "/"))
+		}
+	}
+	return routes
+}
+
+// httpRouteRoutes lists the hosts and paths of an HTTPRoute.
+func httpRouteRoutes(res *Resource) []string {
+	if res == nil {
+		return nil
+	}
+	hosts := stringList(res.Object, "spec.hostnames")
+	if len(hosts) == 0 {
+		hosts = []string{"*"}
+	}
+	paths := make([]string, 0)
+	for _, rule := range fieldList(res, "spec.rules") {
+		matches, _ := lookupField(rule, "matches")
+		list, _ := matches.([]interface{})
+		for _, match := range list {
+			paths = append(paths, stringOr(match, "path.value", "/"))
+		}
+		if len(list) == 0 {
+			paths = append(paths, "/")
+		}
+	}
+	routes := make([]string, 0, len(hosts)*len(paths))
+	for _, host := range hosts {
+		for _, path := range paths {
+			routes = append(routes, host+path)
+		}
+	}
+	return routes
+}
+
+func routeExposure(baseRoutes, targetRoutes []string) []findingMessage {
+	messages := make([]findingMessage, 0)
+	for _, route := range stringsDifference(targetRoutes, baseRoutes) {
+		messages = append(messages, findingMessage{SeverityMedium, fmt.Sprintf("route `%s` is added", route)})
+	}
+	return messages
+}
+
+func gatewayExposure(base, target *Resource) []findingMessage {
+	listeners := func(res *Resource) []string {
+		if res == nil {
+			return nil
+		}
+		list := make([]string, 0)
+		for _, listener := range fieldList(res, "spec.listeners") {
+			port, _ := lookupField(listener, "port")
+			list = append(list, fmt.Sprintf("%s %s:%v", stringOr(listener, "protocol", "HTTP"), stringOr(listener, "hostname", "*"), port))
+		}
+		return list
+	}
+	messages := make([]findingMessage, 0)
+	for _, listener := range stringsDifference(listeners(target), listeners(base)) {
+		messages = append(messages, findingMessage{SeverityMedium, fmt.Sprintf("listener `%s` is added", listener)})
+	}
+	return messages
+}
+
+func networkPolicyExposure(base, target *Resource) []findingMessage {
+	messages := make([]findingMessage, 0)
+	if fieldChanged(base, target, "spec.podSelector") {
+		messages = append(messages, findingMessage{SeverityMedium, "pod selector is changed"})
+	}
+	targetTypes := policyTypes(target)
+	for _, direction := range []struct {
+		policyType string
+		rules      string
+		peers      string
+	}{
+		{"Ingress", "spec.ingress", "from"},
+		{"Egress", "spec.egress", "to"},
+	} {
+		if _, ok := policyTypes(base)[direction.policyType]; !ok {
+			continue
+		}
+		if _, ok := targetTypes[direction.policyType]; !ok {
+			messages = append(messages, findingMessage{SeverityHigh, fmt.Sprintf("%s is no longer restricted", strings.ToLower(direction.policyType))})
+			continue
+		}
+		baseRules := fieldList(base, direction.rules)
+		for _, rule := range fieldList(target, direction.rules) {
+			if containsValue(baseRules, rule) {
+				continue
+			}
+			peers, _ := lookupField(rule, direction.peers)
+			if list, _ := peers.([]interface{}); len(list) == 0 {
+				messages = append(messages, findingMessage{SeverityHigh, fmt.Sprintf("%s rule allowing any peer is added", strings.ToLower(direction.policyType))})
+			} else {
+				messages = append(messages, findingMessage{SeverityMedium, fmt.Sprintf("%s rule is added or loosened", strings.ToLower(direction.policyType))})
+			}
+		}
+	}
+	return messages
+}
+
+// policyTypes returns the policy types, which default to Ingress and Egress if
+// there are egress rules.
+func policyTypes(res *Resource) map[string]struct{} {
+	types := map[string]struct{}{}
+	for _, policyType := range stringList(res.Object, "spec.policyTypes") {
+		types[policyType] = struct{}{}
+	}
+	if len(types) == 0 {
+		types["Ingress"] = struct{}{}
+		if _, ok := res.Field("spec.egress"); ok {
+			types["Egress"] = struct{}{}
+		}
+	}
+	return types
+}
+
+func hostExposure(base, target *Resource, podSpecPath string) []findingMessage {
+	messages := make([]findingMessage, 0)
+	if optionalFieldString(target, podSpecPath+".hostNetwork") == "true" && optionalFieldString(base, podSpecPath+".hostNetwork") != "true" {
+		messages = append(messages, findingMessage{SeverityHigh, "host network is used"})
+	}
+	hostPorts := func(res *Resource) []string {
+		if res == nil {
+			return nil
+		}
+		ports := make([]string, 0)
+		for _, containers := range []string{"initContainers", "containers"} {
+			for _, container := range fieldList(res, podSpecPath+"."+containers) {
+				name, _ := lookupField(container, "name")
+				list, _ := lookupField(container, "ports")
+				portList, _ := list.([]interface{})
+				for _, port := range portList {
+					if hostPort, ok := lookupField(port, "hostPort"); ok {
+						ports = append(ports, fmt.Sprintf("%v of container `%v`", hostPort, name))
+					}
+				}
+			}
+		}
+		return ports
+	}
+	for _, port := range stringsDifference(hostPorts(target), hostPorts(base)) {
+		messages = append(messages, findingMessage{SeverityHigh, fmt.Sprintf("host port %s is used", port)})
+	}
+	return messages
+}
+
+func changedOrNew(base *Resource) string {
+	if base == nil {
+		return "new"
+	}
+	return "changed to"
+}
+
+func newStrings(base, target *Resource, path string) []string {
+	var baseStrings []string
+	if base != nil {
+		baseStrings = stringList(base.Object, path)
+	}
+	return stringsDifference(stringList(target.Object, path), baseStrings)
+}
+
+func stringOr(obj interface{}, path, defaultValue string) string {
+	value, ok := lookupField(obj, path)
+	if !ok || fmt.Sprint(value) == "" {
+		return defaultValue
+	}
+	return fmt.Sprint(value)
+}
+
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, elem := range list {
+		if reflect.DeepEqual(elem, value) {
+			return true
+		}
+	}
+	return false
+}
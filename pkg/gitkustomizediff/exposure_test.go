@@ -0,0 +1,173 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExposureAnalyzer(t *testing.T) {
+	baseYaml := `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: app
+spec:
+  type: ClusterIP
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+  namespace: app
+spec:
+  rules:
+  - host: app.example.com
+    http:
+      paths:
+      - path: /
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: app
+  namespace: app
+spec:
+  podSelector: {}
+  ingress:
+  - from:
+    - podSelector:
+        matchLabels:
+          app: web
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny-egress
+  namespace: app
+spec:
+  podSelector: {}
+  policyTypes: [Egress]
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        ports:
+        - containerPort: 8080
+`
+	targetYaml := `apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: app
+spec:
+  type: LoadBalancer
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+  namespace: app
+spec:
+  rules:
+  - host: app.example.com
+    http:
+      paths:
+      - path: /
+      - path: /admin
+---
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: app
+  namespace: app
+spec:
+  podSelector: {}
+  ingress:
+  - {}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: app
+spec:
+  template:
+    spec:
+      hostNetwork: true
+      containers:
+      - name: app
+        ports:
+        - containerPort: 8080
+          hostPort: 80
+---
+apiVersion: gateway.networking.k8s.io/v1
+kind: HTTPRoute
+metadata:
+  name: api
+  namespace: app
+spec:
+  hostnames: [api.example.com]
+  rules:
+  - matches:
+    - path:
+        value: /v1
+`
+	base, target := parseTestBuilds(t, baseYaml, targetYaml)
+	findings := analyzeTestBuilds(t, &ExposureAnalyzer{}, base, target)
+	service := ResourceID{Kind: "Service", Namespace: "app", Name: "app"}
+	ingress := ResourceID{Group: "networking.k8s.io", Kind: "Ingress", Namespace: "app", Name: "app"}
+	networkPolicy := ResourceID{Group: "networking.k8s.io", Kind: "NetworkPolicy", Namespace: "app", Name: "app"}
+	deployment := ResourceID{Group: "apps", Kind: "Deployment", Namespace: "app", Name: "app"}
+	httpRoute := ResourceID{Group: "gateway.networking.k8s.io", Kind: "HTTPRoute", Namespace: "app", Name: "api"}
+	assert.Equal(t, []*Finding{
+		{Severity: SeverityHigh, ID: service, Message: "type is changed to `LoadBalancer`"},
+		{Severity: SeverityMedium, ID: ingress, Message: "route `app.example.com/admin` is added"},
+		{Severity: SeverityHigh, ID: networkPolicy, Message: "ingress rule allowing any peer is added"},
+		{Severity: SeverityHigh, ID: deployment, Message: "host network is used"},
+		{Severity: SeverityHigh, ID: deployment, Message: "host port 80 of container `app` is used"},
+		{Severity: SeverityMedium, ID: httpRoute, Message: "route `api.example.com/v1` is added"},
+		{Severity: SeverityHigh, ID: ResourceID{Group: "networking.k8s.io", Kind: "NetworkPolicy", Namespace: "app", Name: "deny-egress"}, Message: "NetworkPolicy is deleted"},
+	}, findings)
+
+	findings = analyzeTestBuilds(t, &ExposureAnalyzer{}, target, target)
+	assert.Empty(t, findings)
+}
+
+func TestExposureAnalyzerNetworkPolicyTypes(t *testing.T) {
+	networkPolicy := func(policyTypes string) string {
+		return `apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: app
+spec:
+  podSelector: {}
+  policyTypes: ` + policyTypes + "\n"
+	}
+	base, target := parseTestBuilds(t, networkPolicy("[Ingress, Egress]"), networkPolicy("[Ingress]"))
+	findings := analyzeTestBuilds(t, &ExposureAnalyzer{}, base, target)
+	assert.Equal(t, []*Finding{{Severity: SeverityHigh, ID: base[0].ID, Message: "egress is no longer restricted"}}, findings)
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ImagePath is a path of containers in resources of a kind. The value at the
+// path is either a list of containers or an image.
+type ImagePath struct {
+	Kind string
+	Path string
+	Init bool
+}
+
+func ParseImagePath(s string) (*ImagePath, error) {
+	kv := strings.SplitN(s, ":", 2)
+	if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+		return nil, errors.Errorf("invalid image path: %q (expected Kind:path)", s)
+	}
+	return &ImagePath{Kind: kv[0], Path: kv[1]}, nil
+}
+
+var podSpecPaths = map[string]string{
+	"Pod":         "spec",
+	"Deployment":  "spec.template.spec",
+	"StatefulSet": "spec.template.spec",
+	"DaemonSet":   "spec.template.spec",
+	"ReplicaSet":  "spec.template.spec",
+	"Job":         "spec.template.spec",
+	"CronJob":     "spec.jobTemplate.spec.template.spec",
+}
+
+var defaultImagePaths = func() []*ImagePath {
+	paths := make([]*ImagePath, 0, len(podSpecPaths)*2)
+	for kind, path := range podSpecPaths {
+		paths = append(paths,
+			&ImagePath{Kind: kind, Path: path + ".initContainers", Init: true},
+			&ImagePath{Kind: kind, Path: path + ".containers"},
+		)
+	}
+	return paths
+}()
+
+type ImageInventory struct {
+	// CustomPaths are the paths of containers in custom resources.
+	CustomPaths []*ImagePath
+}
+
+type ContainerImage struct {
+	ID        ResourceID
+	Container string
+	Init      bool
+	Image     string
+}
+
+type ImageChange struct {
+	ID        ResourceID
+	Container string
+	Init      bool
+	// OldImage or NewImage is empty if the container is added or removed.
+	OldImage string
+	NewImage string
+}
+
+// Images extracts the images of the containers in the resources.
+func (inv *ImageInventory) Images(resources []*Resource) []*ContainerImage {
+	images := make([]*ContainerImage, 0)
+	paths := append(append([]*ImagePath{}, defaultImagePaths...), inv.CustomPaths...)
+	for _, res := range resources {
+		// The init containers go first as they run first.
+		for _, init := range []bool{true, false} {
+			for _, path := range paths {
+				if path.Kind != res.ID.Kind || path.Init != init {
+					continue
+				}
+				value, ok := res.Field(path.Path)
+				if !ok {
+					continue
+				}
+				if image, ok := value.(string); ok {
+					images = append(images, &ContainerImage{ID: res.ID, Container: path.Path, Init: init, Image: image})
+					continue
+				}
+				containers, _ := value.([]interface{})
+				for _, container := range containers {
+					name, _ := lookupField(container, "name")
+					image, ok := lookupField(container, "image")
+					if !ok {
+						continue
+					}
+					images = append(images, &ContainerImage{ID: res.ID, Container: fmt.Sprint(name), Init: init, Image: fmt.Sprint(image)})
+				}
+			}
+		}
+	}
+	return images
+}
+
+// Changes lists the containers whose images are changed, added or removed.
+func (inv *ImageInventory) Changes(base, target []*Resource) []*ImageChange {
+	type containerKey struct {
+		ID        ResourceID
+		Container string
+		Init      bool
+	}
+	baseImages := map[containerKey]string{}
+	for _, image := range inv.Images(base) {
+		baseImages[containerKey{image.ID, image.Container, image.Init}] = image.Image
+	}
+	changes := make([]*ImageChange, 0)
+	seen := map[containerKey]struct{}{}
+	for _, image := range inv.Images(target) {
+		key := containerKey{image.ID, image.Container, image.Init}
+		seen[key] = struct{}{}
+		if baseImages[key] == image.Image {
+			continue
+		}
+		changes = append(changes, &ImageChange{ID: image.ID, Container: image.Container, Init: image.Init, OldImage: baseImages[key], NewImage: image.Image})
+	}
+	for _, image := range inv.Images(base) {
+		key := containerKey{image.ID, image.Container, image.Init}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		changes = append(changes, &ImageChange{ID: image.ID, Container: image.Container, Init: image.Init, OldImage: image.Image})
+	}
+	return changes
+}
+
+// SplitImage splits an image into the name and the tag or digest.
+func SplitImage(image string) (string, string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, ""
+}
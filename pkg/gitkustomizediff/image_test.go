@@ -0,0 +1,124 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageInventory(t *testing.T) {
+	baseYaml := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: app:1.0
+      containers:
+      - name: app
+        image: app:1.0
+      - name: sidecar
+        image: envoy:1.20
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: cleanup
+            image: busybox:1.34
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web@sha256:aaa
+`
+	targetYaml := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: app:1.1
+      containers:
+      - name: app
+        image: app:1.1
+      - name: sidecar
+        image: envoy:1.20
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Rollout
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web@sha256:bbb
+`
+	base, target := parseTestBuilds(t, baseYaml, targetYaml)
+	rolloutPath, err := ParseImagePath("Rollout:spec.template.spec.containers")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	inventory := &ImageInventory{CustomPaths: []*ImagePath{rolloutPath}}
+	deploymentID := ResourceID{Group: "apps", Kind: "Deployment", Name: "app"}
+	assert.Equal(t, []*ImageChange{
+		{ID: deploymentID, Container: "migrate", Init: true, OldImage: "app:1.0", NewImage: "app:1.1"},
+		{ID: deploymentID, Container: "app", OldImage: "app:1.0", NewImage: "app:1.1"},
+		{ID: ResourceID{Group: "argoproj.io", Kind: "Rollout", Name: "web"}, Container: "web", OldImage: "web@sha256:aaa", NewImage: "web@sha256:bbb"},
+		{ID: ResourceID{Group: "batch", Kind: "CronJob", Name: "cleanup"}, Container: "cleanup", OldImage: "busybox:1.34"},
+	}, inventory.Changes(base, target))
+
+	assert.Len(t, (&ImageInventory{}).Changes(base, target), 3)
+
+	_, err = ParseImagePath("Rollout")
+	assert.Error(t, err)
+}
+
+func TestSplitImage(t *testing.T) {
+	for image, expected := range map[string][]string{
+		"nginx":                          {"nginx", ""},
+		"nginx:1.21":                     {"nginx", "1.21"},
+		"localhost:5000/nginx":           {"localhost:5000/nginx", ""},
+		"localhost:5000/nginx:1.21":      {"localhost:5000/nginx", "1.21"},
+		"ghcr.io/owner/app@sha256:abcde": {"ghcr.io/owner/app", "sha256:abcde"},
+	} {
+		name, ref := SplitImage(image)
+		assert.Equal(t, expected, []string{name, ref}, image)
+	}
+}
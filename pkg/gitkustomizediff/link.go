@@ -0,0 +1,161 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
+	"github.com/pkg/errors"
+)
+
+type RepoProvider string
+
+const (
+	RepoProviderGitHub    RepoProvider = "github"
+	RepoProviderGitLab    RepoProvider = "gitlab"
+	RepoProviderBitbucket RepoProvider = "bitbucket"
+	RepoProviderGitea     RepoProvider = "gitea"
+)
+
+// RepoLinks builds the links to the web view of the repo. The methods of
+// nil RepoLinks return empty strings.
+type RepoLinks struct {
+	URL      string
+	Provider RepoProvider
+	// Prefix is the repo-relative path of the dir the reported paths are
+	// relative to.
+	Prefix string
+}
+
+func NewRepoLinks(repoURL string, provider RepoProvider, prefix string) (*RepoLinks, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return nil, errors.Errorf("invalid repo URL: %q", repoURL)
+	}
+	if provider == "" {
+		provider = detectRepoProvider(u.Hostname())
+	}
+	switch provider {
+	case RepoProviderGitHub, RepoProviderGitLab, RepoProviderBitbucket, RepoProviderGitea:
+	default:
+		return nil, errors.Errorf("unknown repo provider: %q", provider)
+	}
+	return &RepoLinks{
+		URL:      strings.TrimSuffix(repoURL, "/"),
+		Provider: provider,
+		Prefix:   filepath.ToSlash(filepath.Clean(prefix)),
+	}, nil
+}
+
+func detectRepoProvider(host string) RepoProvider {
+	for _, provider := range []RepoProvider{RepoProviderGitLab, RepoProviderBitbucket, RepoProviderGitea} {
+		if strings.Contains(host, string(provider)) {
+			return provider
+		}
+	}
+	return RepoProviderGitHub
+}
+
+// Path converts a path relative to the prefix into a repo-relative one.
+func (l *RepoLinks) Path(p string) string {
+	if l != nil {
+		p = path.Join(l.Prefix, filepath.ToSlash(p))
+	}
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// TreeURL returns the URL of a repo-relative dir at the commit.
+func (l *RepoLinks) TreeURL(commit, p string) string {
+	if l == nil {
+		return ""
+	}
+	switch l.Provider {
+	case RepoProviderGitLab:
+		return fmt.Sprintf("%s/-/tree/%s/%s", l.URL, commit, p)
+	case RepoProviderBitbucket:
+		return fmt.Sprintf("%s/src/%s/%s", l.URL, commit, p)
+	case RepoProviderGitea:
+		return fmt.Sprintf("%s/src/commit/%s/%s", l.URL, commit, p)
+	default:
+		return fmt.Sprintf("%s/tree/%s/%s", l.URL, commit, p)
+	}
+}
+
+// BlobURL returns the URL of a repo-relative file at the commit.
+func (l *RepoLinks) BlobURL(commit, p string) string {
+	if l == nil {
+		return ""
+	}
+	switch l.Provider {
+	case RepoProviderGitLab:
+		return fmt.Sprintf("%s/-/blob/%s/%s", l.URL, commit, p)
+	case RepoProviderBitbucket:
+		return fmt.Sprintf("%s/src/%s/%s", l.URL, commit, p)
+	case RepoProviderGitea:
+		return fmt.Sprintf("%s/src/commit/%s/%s", l.URL, commit, p)
+	default:
+		return fmt.Sprintf("%s/blob/%s/%s", l.URL, commit, p)
+	}
+}
+
+func (l *RepoLinks) CommitURL(commit string) string {
+	if l == nil {
+		return ""
+	}
+	switch l.Provider {
+	case RepoProviderGitLab:
+		return fmt.Sprintf("%s/-/commit/%s", l.URL, commit)
+	case RepoProviderBitbucket:
+		return fmt.Sprintf("%s/commits/%s", l.URL, commit)
+	default:
+		return fmt.Sprintf("%s/commit/%s", l.URL, commit)
+	}
+}
+
+func (l *RepoLinks) CompareURL(base, target string) string {
+	if l == nil {
+		return ""
+	}
+	switch l.Provider {
+	case RepoProviderGitLab:
+		return fmt.Sprintf("%s/-/compare/%s...%s", l.URL, base, target)
+	case RepoProviderBitbucket:
+		return fmt.Sprintf("%s/branches/compare/%s%%0D%s", l.URL, target, base)
+	default:
+		return fmt.Sprintf("%s/compare/%s...%s", l.URL, base, target)
+	}
+}
+
+// resolveRepoLinks returns nil without a repo URL.
+func resolveRepoLinks(gitDir *utils.GitDir, repoURL string, provider RepoProvider, dirPath string) (*RepoLinks, error) {
+	if repoURL == "" {
+		return nil, nil
+	}
+	prefix, err := gitDir.Prefix()
+	if err != nil {
+		return nil, err
+	}
+	return NewRepoLinks(repoURL, provider, filepath.Join(filepath.FromSlash(prefix), dirPath))
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoLinks(t *testing.T) {
+	for _, c := range []struct {
+		url      string
+		provider RepoProvider
+		tree     string
+		blob     string
+		commit   string
+		compare  string
+	}{
+		{
+			url:     "https://github.com/owner/repo/",
+			tree:    "https://github.com/owner/repo/tree/abc/k8s/foo",
+			blob:    "https://github.com/owner/repo/blob/abc/k8s/foo/kustomization.yaml",
+			commit:  "https://github.com/owner/repo/commit/abc",
+			compare: "https://github.com/owner/repo/compare/base...abc",
+		},
+		{
+			url:     "https://gitlab.example.com/group/repo",
+			tree:    "https://gitlab.example.com/group/repo/-/tree/abc/k8s/foo",
+			blob:    "https://gitlab.example.com/group/repo/-/blob/abc/k8s/foo/kustomization.yaml",
+			commit:  "https://gitlab.example.com/group/repo/-/commit/abc",
+			compare: "https://gitlab.example.com/group/repo/-/compare/base...abc",
+		},
+		{
+			url:     "https://bitbucket.org/owner/repo",
+			tree:    "https://bitbucket.org/owner/repo/src/abc/k8s/foo",
+			blob:    "https://bitbucket.org/owner/repo/src/abc/k8s/foo/kustomization.yaml",
+			commit:  "https://bitbucket.org/owner/repo/commits/abc",
+			compare: "https://bitbucket.org/owner/repo/branches/compare/abc%0Dbase",
+		},
+		{
+			url:      "https://git.example.com/owner/repo",
+			provider: RepoProviderGitea,
+			tree:     "https://git.example.com/owner/repo/src/commit/abc/k8s/foo",
+			blob:     "https://git.example.com/owner/repo/src/commit/abc/k8s/foo/kustomization.yaml",
+			commit:   "https://git.example.com/owner/repo/commit/abc",
+			compare:  "https://git.example.com/owner/repo/compare/base...abc",
+		},
+	} {
+		links, err := NewRepoLinks(c.url, c.provider, "k8s")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		assert.Equal(t, c.tree, links.TreeURL("abc", links.Path("foo")))
+		assert.Equal(t, c.blob, links.BlobURL("abc", links.Path("foo/kustomization.yaml")))
+		assert.Equal(t, c.commit, links.CommitURL("abc"))
+		assert.Equal(t, c.compare, links.CompareURL("base", "abc"))
+	}
+
+	var links *RepoLinks
+	assert.Equal(t, "", links.TreeURL("abc", "foo"))
+	assert.Equal(t, "foo", links.Path("foo"))
+
+	_, err := NewRepoLinks("github.com/owner/repo", "", "")
+	assert.Error(t, err)
+	_, err = NewRepoLinks("https://github.com/owner/repo", "unknown", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type LogOpts struct {
+	Base                    string
+	Target                  string
+	Remote                  string
+	IncludeRegexp           *regexp.Regexp
+	ExcludeRegexp           *regexp.Regexp
+	KustomizePath           string
+	KustomizeLoadRestrictor string
+	CacheDir                string
+	SkipUnchanged           bool
+	GitPath                 string
+	Debug                   bool
+	FirstParent             bool
+	Fetch                   bool
+	RepoURL                 string
+	RepoProvider            RepoProvider
+}
+
+type CommitDiff struct {
+	Commit string
+	// ParentCommit is empty for a root commit, which is compared with an
+	// empty build.
+	ParentCommit string
+	Subject      string
+	DiffMap      *DiffMap
+}
+
+type LogResult struct {
+	BaseCommit   string
+	TargetCommit string
+	Base         *utils.CommitInfo
+	Target       *utils.CommitInfo
+	// MergeBase is nil if the commits have no common ancestor.
+	MergeBase *utils.CommitInfo
+	Commits   []*CommitDiff
+	// Links is nil without a repo URL.
+	Links *RepoLinks
+}
+
+func Log(dirPath string, opts LogOpts) (*LogResult, error) {
+	log.Info("Start log")
+	currentGitDir := utils.NewGitDir(dirPath, opts.GitPath)
+	if opts.Fetch {
+		err := fetch(currentGitDir, opts.Remote)
+		if err != nil {
+			return nil, err
+		}
+	}
+	base, target, err := resolveCommits(currentGitDir, opts.Remote, opts.Base, opts.Target)
+	if err != nil {
+		return nil, err
+	}
+	baseCommit, targetCommit := base.Hash, target.Hash
+	mergeBase, err := resolveMergeBase(currentGitDir, baseCommit, targetCommit)
+	if err != nil {
+		return nil, err
+	}
+	links, err := resolveRepoLinks(currentGitDir, opts.RepoURL, opts.RepoProvider, "")
+	if err != nil {
+		return nil, err
+	}
+
+	revListArgs := []string{"--reverse"}
+	if opts.FirstParent {
+		revListArgs = append(revListArgs, "--first-parent")
+	}
+	revListArgs = append(revListArgs, fmt.Sprintf("%s..%s", baseCommit, targetCommit))
+	commits, err := currentGitDir.RevList(revListArgs...)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("commits: %+v", commits)
+
+	res := &LogResult{
+		BaseCommit:   baseCommit,
+		TargetCommit: targetCommit,
+		Base:         base,
+		Target:       target,
+		MergeBase:    mergeBase,
+		Commits:      make([]*CommitDiff, 0, len(commits)),
+		Links:        links,
+	}
+	if len(commits) == 0 {
+		return res, nil
+	}
+
+	log.Infof("Clone the git repo at %s for parents", baseCommit)
+	parentDirPath, err := ioutil.TempDir("", "git-kustomize-diff-parent-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if opts.Debug {
+		log.Infof("Parent repo path: %s", parentDirPath)
+	} else {
+		defer os.RemoveAll(parentDirPath)
+	}
+	parentGitDir, err := currentGitDir.CloneAndCheckout(parentDirPath, baseCommit)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Clone the git repo at %s for commits", baseCommit)
+	commitDirPath, err := ioutil.TempDir("", "git-kustomize-diff-commit-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if opts.Debug {
+		log.Infof("Commit repo path: %s", commitDirPath)
+	} else {
+		defer os.RemoveAll(commitDirPath)
+	}
+	commitGitDir, err := currentGitDir.CloneAndCheckout(commitDirPath, baseCommit)
+	if err != nil {
+		return nil, err
+	}
+
+	emptyDirPath, err := ioutil.TempDir("", "git-kustomize-diff-empty-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer os.RemoveAll(emptyDirPath)
+
+	for _, commit := range commits {
+		parents, err := currentGitDir.Parents(commit)
+		if err != nil {
+			return nil, err
+		}
+		parentCommit := ""
+		parentDirPath := emptyDirPath
+		if len(parents) > 0 {
+			parentCommit = parents[0]
+			parentDirPath = parentGitDir.WorkDir.Dir
+		}
+		info, err := currentGitDir.CommitInfo(commit)
+		if err != nil {
+			return nil, err
+		}
+		log.Infof("Diff the commit at %s against %s", commit, parentCommit)
+		for _, c := range []struct {
+			gitDir *utils.GitDir
+			commit string
+		}{{parentGitDir, parentCommit}, {commitGitDir, commit}} {
+			if c.commit == "" {
+				continue
+			}
+			// Remove untracked files such as generated ones, which would block the next checkout.
+			err = c.gitDir.Clean()
+			if err != nil {
+				return nil, err
+			}
+			err = c.gitDir.Checkout(c.commit)
+			if err != nil {
+				return nil, err
+			}
+		}
+		diffMap, err := Diff(parentDirPath, commitGitDir.WorkDir.Dir, DiffOpts{
+			IncludeRegexp:           opts.IncludeRegexp,
+			ExcludeRegexp:           opts.ExcludeRegexp,
+			KustomizePath:           opts.KustomizePath,
+			KustomizeLoadRestrictor: opts.KustomizeLoadRestrictor,
+			CacheDir:                opts.CacheDir,
+			SkipUnchanged:           opts.SkipUnchanged,
+		})
+		if err != nil {
+			return nil, err
+		}
+		res.Commits = append(res.Commits, &CommitDiff{
+			Commit:       commit,
+			ParentCommit: parentCommit,
+			Subject:      info.Subject,
+			DiffMap:      diffMap,
+		})
+	}
+
+	return res, nil
+}
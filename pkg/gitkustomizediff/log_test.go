@@ -0,0 +1,97 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	expectedFooDiff := strings.TrimLeft(`
+@@ -4,5 +4,5 @@
+   name: foo
+ spec:
+   containers:
+-  - image: nginx:1.0
++  - image: nginx:1.1
+     name: foo
+`, "\n")
+
+	repo := newTestRepo(t)
+	repo.writePod("foo", "foo", "nginx:1.0")
+	repo.writePod("bar", "bar", "nginx:1.0")
+	baseCommit := repo.commit("initial")
+	repo.git("checkout", "-q", "-b", "feature")
+	repo.write("README.md", "readme\n")
+	docCommit := repo.commit("add readme")
+	repo.writePod("foo", "foo", "nginx:1.1")
+	fooCommit := repo.commit("bump foo")
+	repo.writePod("baz", "baz", "nginx:1.0")
+	bazCommit := repo.commit("add baz")
+
+	res, err := Log(repo.workDir.Dir, LogOpts{
+		Base:   "main",
+		Target: "feature",
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, baseCommit, res.BaseCommit)
+	assert.Equal(t, bazCommit, res.TargetCommit)
+	assert.Equal(t, "main", res.Base.Ref)
+	assert.Equal(t, "initial", res.Base.Subject)
+	assert.Equal(t, "feature", res.Target.Ref)
+	assert.Equal(t, "add baz", res.Target.Subject)
+	assert.Equal(t, baseCommit, res.MergeBase.Hash)
+	if !assert.Equal(t, 3, len(res.Commits)) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, docCommit, res.Commits[0].Commit)
+	assert.Equal(t, baseCommit, res.Commits[0].ParentCommit)
+	assert.Equal(t, "add readme", res.Commits[0].Subject)
+	assert.Equal(t, []string{}, res.Commits[0].DiffMap.ChangedDirs())
+
+	assert.Equal(t, fooCommit, res.Commits[1].Commit)
+	assert.Equal(t, "bump foo", res.Commits[1].Subject)
+	assert.Equal(t, []string{"foo"}, res.Commits[1].DiffMap.ChangedDirs())
+	assert.Equal(t, expectedFooDiff, res.Commits[1].DiffMap.Results["foo"].ToString())
+
+	assert.Equal(t, bazCommit, res.Commits[2].Commit)
+	assert.Equal(t, []string{"baz"}, res.Commits[2].DiffMap.ChangedDirs())
+
+	// A root commit of an unrelated history is compared with an empty build.
+	repo.git("checkout", "-q", "--orphan", "unrelated")
+	repo.git("rm", "-q", "-rf", ".")
+	repo.writePod("qux", "qux", "nginx:1.0")
+	repo.commit("add qux")
+	res, err = Log(repo.workDir.Dir, LogOpts{
+		Base:   "main",
+		Target: "unrelated",
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.Equal(t, 1, len(res.Commits)) {
+		t.FailNow()
+	}
+	assert.Equal(t, "", res.Commits[0].ParentCommit)
+	assert.Equal(t, []string{"qux"}, res.Commits[0].DiffMap.ChangedDirs())
+}
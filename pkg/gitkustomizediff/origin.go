@@ -0,0 +1,209 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/kustomize/api/provider"
+	"sigs.k8s.io/kustomize/api/resmap"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+const originAnnotation = "config.kubernetes.io/origin"
+
+// originFs enables the origin annotations of kustomize by adding them to the
+// build metadata of the top-level kustomization, which is inherited by the
+// bases.
+type originFs struct {
+	filesys.FileSystem
+	kustomizationPath string
+}
+
+func newOriginFs(fSys filesys.FileSystem, dirPath string) (*originFs, error) {
+	kustomizationPath, err := utils.KustomizationFilePath(fSys, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	// kustomize reads the files by the confirmed paths.
+	confirmedDirPath, _, err := fSys.CleanedAbs(dirPath)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &originFs{
+		FileSystem:        fSys,
+		kustomizationPath: filepath.Join(string(confirmedDirPath), filepath.Base(kustomizationPath)),
+	}, nil
+}
+
+func (fs *originFs) ReadFile(path string) ([]byte, error) {
+	bs, err := fs.FileSystem.ReadFile(path)
+	if err != nil || filepath.Clean(path) != fs.kustomizationPath {
+		return bs, err
+	}
+	node, err := yaml.Parse(string(bs))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
+	}
+	err = node.PipeE(yaml.LookupCreate(yaml.SequenceNode, "buildMetadata"), yaml.Append(yaml.NewScalarRNode("originAnnotations").YNode()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	s, err := node.String()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return []byte(s), nil
+}
+
+// stripOrigins removes the origin annotations from the build output and
+// returns them by resource.
+func stripOrigins(content string) (string, map[ResourceID]string, error) {
+	origins := map[ResourceID]string{}
+	if content == "" {
+		return content, origins, nil
+	}
+	rm, err := resmap.NewFactory(provider.NewDefaultDepProvider().GetResourceFactory()).NewResMapFromBytes([]byte(content))
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+	for _, res := range rm.Resources() {
+		annotations := res.GetAnnotations()
+		origin, ok := annotations[originAnnotation]
+		if !ok {
+			continue
+		}
+		delete(annotations, originAnnotation)
+		err = res.SetAnnotations(annotations)
+		if err != nil {
+			return "", nil, errors.WithStack(err)
+		}
+		origins[newResourceID(&res.RNode)] = origin
+	}
+	bs, err := rm.AsYaml()
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+	return string(bs), origins, nil
+}
+
+// originSources resolves the resources of a kustomization to the files which
+// produced or patched them.
+type originSources struct {
+	dirPath    string
+	kDir       string
+	pathPrefix string
+	origins    map[ResourceID]string
+	patches    []*utils.KustomizationPatch
+}
+
+func newOriginSources(fSys filesys.FileSystem, dirPath, kDir, pathPrefix string, origins map[ResourceID]string, exists bool) (*originSources, error) {
+	s := &originSources{
+		dirPath:    dirPath,
+		kDir:       kDir,
+		pathPrefix: pathPrefix,
+		origins:    origins,
+	}
+	if exists {
+		patches, err := utils.ListKustomizationPatches(fSys, filepath.Join(dirPath, kDir))
+		if err != nil {
+			return nil, err
+		}
+		s.patches = patches
+	}
+	return s, nil
+}
+
+func (s *originSources) files(id ResourceID) []string {
+	files := make([]string, 0)
+	seen := map[string]struct{}{}
+	add := func(file string) {
+		if _, ok := seen[file]; !ok {
+			seen[file] = struct{}{}
+			files = append(files, file)
+		}
+	}
+	if origin, ok := s.origins[id]; ok {
+		path, repo, ref := parseOrigin(origin)
+		if repo == "" {
+			add(s.repoPath(filepath.Join(s.kDir, path)))
+		} else if ref == "" {
+			add(fmt.Sprintf("%s//%s", repo, path))
+		} else {
+			add(fmt.Sprintf("%s//%s?ref=%s", repo, path, ref))
+		}
+	}
+	for _, patch := range s.patches {
+		if !patch.Match(id.Kind, id.Name) {
+			continue
+		}
+		relPath, err := filepath.Rel(s.dirPath, patch.Path)
+		if err != nil {
+			continue
+		}
+		add(s.repoPath(relPath))
+	}
+	return files
+}
+
+func (s *originSources) repoPath(path string) string {
+	return filepath.ToSlash(filepath.Clean(filepath.Join(s.pathPrefix, path)))
+}
+
+func parseOrigin(origin string) (string, string, string) {
+	values := map[string]string{}
+	for _, line := range strings.Split(origin, "\n") {
+		kv := strings.SplitN(line, ": ", 2)
+		if len(kv) == 2 {
+			values[kv[0]] = kv[1]
+		}
+	}
+	return values["path"], values["repo"], values["ref"]
+}
+
+func resourceSources(baseYaml, targetYaml string, baseSources, targetSources *originSources) ([]*ResourceSource, error) {
+	baseResources, err := ParseResources(baseYaml)
+	if err != nil {
+		return nil, err
+	}
+	targetResources, err := ParseResources(targetYaml)
+	if err != nil {
+		return nil, err
+	}
+	diffs, err := DiffResources(baseResources, targetResources, ResourceDiffOpts{})
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]*ResourceSource, 0, len(diffs))
+	for _, diff := range diffs {
+		s := targetSources
+		if diff.Type == ResourceRemoved {
+			s = baseSources
+		}
+		sources = append(sources, &ResourceSource{
+			ID:    diff.ID,
+			Type:  diff.Type,
+			Files: s.files(diff.ID),
+		})
+	}
+	return sources, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+func TestOriginFs(t *testing.T) {
+	fSys := filesys.MakeFsInMemory()
+	for path, content := range map[string]string{
+		"/app/kustomization.yaml":      "resources:\n- pod.yaml\nbuildMetadata:\n- managedByLabel\n",
+		"/app/pod.yaml":                "kind: Pod\n",
+		"/app/base/kustomization.yaml": "resources: []\n",
+	} {
+		err := fSys.WriteFile(path, []byte(content))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+
+	fs, err := newOriginFs(fSys, "/app")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	bs, err := fs.ReadFile("/app/kustomization.yaml")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "resources:\n- pod.yaml\nbuildMetadata:\n- managedByLabel\n- originAnnotations\n", string(bs))
+
+	// The other files including the kustomizations of the bases are kept.
+	for path, expected := range map[string]string{
+		"/app/pod.yaml":                "kind: Pod\n",
+		"/app/base/kustomization.yaml": "resources: []\n",
+	} {
+		bs, err := fs.ReadFile(path)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		assert.Equal(t, expected, string(bs), path)
+	}
+}
+
+func TestStripOrigins(t *testing.T) {
+	content := strings.TrimLeft(`
+apiVersion: v1
+kind: Pod
+metadata:
+  annotations:
+    config.kubernetes.io/origin: |
+      path: pod.yaml
+    foo: bar
+  name: foo
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: bar
+`, "\n")
+
+	stripped, origins, err := stripOrigins(content)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.NotContains(t, stripped, originAnnotation)
+	assert.Contains(t, stripped, "foo: bar")
+	assert.Equal(t, map[ResourceID]string{
+		{Kind: "Pod", Name: "foo"}: "path: pod.yaml\n",
+	}, origins)
+
+	stripped, origins, err = stripOrigins("")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "", stripped)
+	assert.Empty(t, origins)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+)
+
+// baselineCapabilities are the capabilities allowed by the baseline Pod
+// Security Standard.
+var baselineCapabilities = map[string]struct{}{
+	"AUDIT_WRITE":      {},
+	"CHOWN":            {},
+	"DAC_OVERRIDE":     {},
+	"FOWNER":           {},
+	"FSETID":           {},
+	"KILL":             {},
+	"MKNOD":            {},
+	"NET_BIND_SERVICE": {},
+	"SETFCAP":          {},
+	"SETGID":           {},
+	"SETPCAP":          {},
+	"SETUID":           {},
+	"SYS_CHROOT":       {},
+}
+
+// PodSecurityLevel is a level of the Pod Security Standards.
+type PodSecurityLevel string
+
+const (
+	PodSecurityPrivileged PodSecurityLevel = "privileged"
+	PodSecurityBaseline   PodSecurityLevel = "baseline"
+	PodSecurityRestricted PodSecurityLevel = "restricted"
+)
+
+var podSecurityLevelRanks = map[PodSecurityLevel]int{
+	PodSecurityPrivileged: 1,
+	PodSecurityBaseline:   2,
+	PodSecurityRestricted: 3,
+}
+
+// PodSecurityAnalyzer flags the pod specs which get less secure.
+type PodSecurityAnalyzer struct {
+	// Standards enables the comparison of the Pod Security Standards levels.
+	Standards bool
+}
+
+func (a *PodSecurityAnalyzer) Name() string {
+	return "podsecurity"
+}
+
+func (a *PodSecurityAnalyzer) Title() string {
+	return "Pod Security Regressions"
+}
+
+func (a *PodSecurityAnalyzer) Analyze(base, target []*Resource) ([]*Finding, error) {
+	baseMap := resourceMap(base)
+	findings := make([]*Finding, 0)
+	for _, targetRes := range target {
+		path, ok := podSpecPaths[targetRes.ID.Kind]
+		if !ok {
+			continue
+		}
+		targetSpec, _ := targetRes.Field(path)
+		// baseSpec is nil for the new resources.
+		var baseSpec interface{}
+		if baseRes, ok := baseMap[targetRes.ID]; ok {
+			baseSpec, _ = baseRes.Field(path)
+		}
+		for _, message := range podSecurityRegressions(baseSpec, targetSpec) {
+			findings = append(findings, &Finding{Severity: message.severity, ID: targetRes.ID, Message: message.text})
+		}
+		if !a.Standards {
+			continue
+		}
+		targetLevel := PodSecurityLevelOf(targetSpec)
+		if baseSpec == nil {
+			if targetLevel != PodSecurityRestricted {
+				findings = append(findings, &Finding{
+					Severity: SeverityLow,
+					ID:       targetRes.ID,
+					Message:  fmt.Sprintf("Pod Security Standards level is `%s`", targetLevel),
+				})
+			}
+			continue
+		}
+		baseLevel := PodSecurityLevelOf(baseSpec)
+		if podSecurityLevelRanks[targetLevel] < podSecurityLevelRanks[baseLevel] {
+			severity := SeverityMedium
+			if targetLevel == PodSecurityPrivileged {
+				severity = SeverityHigh
+			}
+			findings = append(findings, &Finding{
+				Severity: severity,
+				ID:       targetRes.ID,
+				Message:  fmt.Sprintf("Pod Security Standards level is lowered from `%s` to `%s`", baseLevel, targetLevel),
+			})
+		}
+	}
+	return findings, nil
+}
+
+func podSecurityRegressions(baseSpec, targetSpec interface{}) []findingMessage {
+	messages := make([]findingMessage, 0)
+	for _, field := range []string{"hostPID", "hostIPC"} {
+		if isTrue(targetSpec, field) && !isTrue(baseSpec, field) {
+			messages = append(messages, findingMessage{SeverityHigh, fmt.Sprintf("`%s` is enabled", field)})
+		}
+	}
+	for _, path := range stringsDifference(hostPaths(targetSpec), hostPaths(baseSpec)) {
+		messages = append(messages, findingMessage{SeverityHigh, fmt.Sprintf("host path `%s` is mounted", path)})
+	}
+
+	baseContainers := map[string]interface{}{}
+	for _, container := range podContainers(baseSpec) {
+		name, _ := lookupField(container, "name")
+		baseContainers[fmt.Sprint(name)] = container
+	}
+	for _, targetContainer := range podContainers(targetSpec) {
+		name, _ := lookupField(targetContainer, "name")
+		// baseContainer is nil for the new containers.
+		baseContainer := baseContainers[fmt.Sprint(name)]
+		if isTrue(targetContainer, "securityContext.privileged") && !isTrue(baseContainer, "securityContext.privileged") {
+			messages = append(messages, findingMessage{SeverityHigh, fmt.Sprintf("container `%v` is privileged", name)})
+		}
+		for _, capability := range stringsDifference(stringList(targetContainer, "securityContext.capabilities.add"), stringList(baseContainer, "securityContext.capabilities.add")) {
+			severity := SeverityMedium
+			if _, ok := baselineCapabilities[capability]; !ok {
+				severity = SeverityHigh
+			}
+			messages = append(messages, findingMessage{severity, fmt.Sprintf("capability `%s` is added to container `%v`", capability, name)})
+		}
+		if baseContainer != nil && runAsNonRoot(baseSpec, baseContainer) && !runAsNonRoot(targetSpec, targetContainer) {
+			messages = append(messages, findingMessage{SeverityHigh, fmt.Sprintf("`runAsNonRoot` is removed from container `%v`", name)})
+		}
+		if isTrue(targetContainer, "securityContext.allowPrivilegeEscalation") && !isTrue(baseContainer, "securityContext.allowPrivilegeEscalation") {
+			messages = append(messages, findingMessage{SeverityMedium, fmt.Sprintf("privilege escalation is allowed in container `%v`", name)})
+		}
+		if baseContainer != nil && confinedSeccomp(seccompProfile(baseSpec, baseContainer)) && !confinedSeccomp(seccompProfile(targetSpec, targetContainer)) {
+			messages = append(messages, findingMessage{SeverityMedium, fmt.Sprintf("seccomp profile is dropped from container `%v`", name)})
+		}
+	}
+	return messages
+}
+
+// PodSecurityLevelOf returns the most restrictive Pod Security Standards level
+// the pod spec satisfies. Only the controls of the containers and the
+// volumes related to the regressions are checked.
+func PodSecurityLevelOf(podSpec interface{}) PodSecurityLevel {
+	if isTrue(podSpec, "hostNetwork") || isTrue(podSpec, "hostPID") || isTrue(podSpec, "hostIPC") || len(hostPaths(podSpec)) > 0 {
+		return PodSecurityPrivileged
+	}
+	restricted := true
+	for _, container := range podContainers(podSpec) {
+		if isTrue(container, "securityContext.privileged") {
+			return PodSecurityPrivileged
+		}
+		ports, _ := lookupField(container, "ports")
+		portList, _ := ports.([]interface{})
+		for _, port := range portList {
+			if hostPort, ok := lookupField(port, "hostPort"); ok && fmt.Sprint(hostPort) != "0" {
+				return PodSecurityPrivileged
+			}
+		}
+		added := stringList(container, "securityContext.capabilities.add")
+		for _, capability := range added {
+			if _, ok := baselineCapabilities[capability]; !ok {
+				return PodSecurityPrivileged
+			}
+			if capability != "NET_BIND_SERVICE" {
+				restricted = false
+			}
+		}
+		profile := seccompProfile(podSpec, container)
+		if profile == "Unconfined" {
+			return PodSecurityPrivileged
+		}
+		if !confinedSeccomp(profile) || !runAsNonRoot(podSpec, container) || !isFalse(container, "securityContext.allowPrivilegeEscalation") {
+			restricted = false
+		}
+		dropsAll := false
+		for _, capability := range stringList(container, "securityContext.capabilities.drop") {
+			if capability == "ALL" {
+				dropsAll = true
+			}
+		}
+		if !dropsAll {
+			restricted = false
+		}
+	}
+	if restricted {
+		return PodSecurityRestricted
+	}
+	return PodSecurityBaseline
+}
+
+func podContainers(podSpec interface{}) []interface{} {
+	containers := make([]interface{}, 0)
+	for _, path := range []string{"initContainers", "containers", "ephemeralContainers"} {
+		value, _ := lookupField(podSpec, path)
+		list, _ := value.([]interface{})
+		containers = append(containers, list...)
+	}
+	return containers
+}
+
+func hostPaths(podSpec interface{}) []string {
+	value, _ := lookupField(podSpec, "volumes")
+	list, _ := value.([]interface{})
+	paths := make([]string, 0)
+	for _, volume := range list {
+		if path, ok := lookupField(volume, "hostPath.path"); ok {
+			paths = append(paths, fmt.Sprint(path))
+		}
+	}
+	return paths
+}
+
+// runAsNonRoot returns the setting of the container, which defaults to the
+// one of the pod.
+func runAsNonRoot(podSpec, container interface{}) bool {
+	if _, ok := lookupField(container, "securityContext.runAsNonRoot"); ok {
+		return isTrue(container, "securityContext.runAsNonRoot")
+	}
+	return isTrue(podSpec, "securityContext.runAsNonRoot")
+}
+
+func seccompProfile(podSpec, container interface{}) string {
+	if profile, ok := lookupField(container, "securityContext.seccompProfile.type"); ok {
+		return fmt.Sprint(profile)
+	}
+	if profile, ok := lookupField(podSpec, "securityContext.seccompProfile.type"); ok {
+		return fmt.Sprint(profile)
+	}
+	return ""
+}
+
+func confinedSeccomp(profile string) bool {
+	return profile == "RuntimeDefault" || profile == "Localhost"
+}
+
+func isTrue(obj interface{}, path string) bool {
+	value, ok := lookupField(obj, path)
+	return ok && value == true
+}
+
+func isFalse(obj interface{}, path string) bool {
+	value, ok := lookupField(obj, path)
+	return ok && value == false
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodSecurityAnalyzer(t *testing.T) {
+	baseYaml := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      securityContext:
+        runAsNonRoot: true
+        seccompProfile:
+          type: RuntimeDefault
+      containers:
+      - name: app
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: [ALL]
+`
+	targetYaml := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      securityContext:
+        seccompProfile:
+          type: Unconfined
+      containers:
+      - name: app
+        securityContext:
+          privileged: true
+          allowPrivilegeEscalation: true
+          capabilities:
+            add: [NET_ADMIN, CHOWN]
+      volumes:
+      - name: docker
+        hostPath:
+          path: /var/run/docker.sock
+`
+	base, target := parseTestBuilds(t, baseYaml, targetYaml)
+	assert.Equal(t, PodSecurityRestricted, PodSecurityLevelOf(mustField(t, base[0], "spec.template.spec")))
+	assert.Equal(t, PodSecurityPrivileged, PodSecurityLevelOf(mustField(t, target[0], "spec.template.spec")))
+
+	findings := analyzeTestBuilds(t, &PodSecurityAnalyzer{Standards: true}, base, target)
+	id := base[0].ID
+	assert.Equal(t, []*Finding{
+		{Severity: SeverityHigh, ID: id, Message: "host path `/var/run/docker.sock` is mounted"},
+		{Severity: SeverityHigh, ID: id, Message: "container `app` is privileged"},
+		{Severity: SeverityMedium, ID: id, Message: "capability `CHOWN` is added to container `app`"},
+		{Severity: SeverityHigh, ID: id, Message: "capability `NET_ADMIN` is added to container `app`"},
+		{Severity: SeverityHigh, ID: id, Message: "`runAsNonRoot` is removed from container `app`"},
+		{Severity: SeverityMedium, ID: id, Message: "privilege escalation is allowed in container `app`"},
+		{Severity: SeverityMedium, ID: id, Message: "seccomp profile is dropped from container `app`"},
+		{Severity: SeverityHigh, ID: id, Message: "Pod Security Standards level is lowered from `restricted` to `privileged`"},
+	}, findings)
+
+	findings = analyzeTestBuilds(t, &PodSecurityAnalyzer{}, target, base)
+	assert.Empty(t, findings)
+}
+
+func TestPodSecurityAnalyzerNewResource(t *testing.T) {
+	target, err := ParseResources(`apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+spec:
+  containers:
+  - name: app
+`)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	findings := analyzeTestBuilds(t, &PodSecurityAnalyzer{}, nil, target)
+	assert.Empty(t, findings)
+
+	findings = analyzeTestBuilds(t, &PodSecurityAnalyzer{Standards: true}, nil, target)
+	assert.Equal(t, []*Finding{{Severity: SeverityLow, ID: target[0].ID, Message: "Pod Security Standards level is `baseline`"}}, findings)
+}
+
+func mustField(t *testing.T, res *Resource, path string) interface{} {
+	value, ok := res.Field(path)
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	return value
+}
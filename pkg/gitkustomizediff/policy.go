@@ -0,0 +1,220 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// PolicyRule is a Starlark expression which every resource of the target
+// builds must satisfy. The expression is evaluated with `resource`, `base`
+// (None for the new resources) and `dir`.
+type PolicyRule struct {
+	Name     string   `yaml:"name"`
+	Severity Severity `yaml:"severity"`
+	// Kinds and Paths restrict the resources by the kinds and the regexps of
+	// the kustomization dirs.
+	Kinds   []string `yaml:"kinds"`
+	Paths   []string `yaml:"paths"`
+	Expr    string   `yaml:"expr"`
+	Message string   `yaml:"message"`
+
+	pathRegexps []*regexp.Regexp
+	expr        syntax.Expr
+}
+
+type Policy struct {
+	Rules []*PolicyRule `yaml:"rules"`
+}
+
+// PolicyAnalyzer reports the resources violating the policy rules.
+type PolicyAnalyzer struct {
+	Rules []*PolicyRule
+}
+
+// LoadPolicyAnalyzer reads the rules from the policy files.
+func LoadPolicyAnalyzer(paths ...string) (*PolicyAnalyzer, error) {
+	analyzer := &PolicyAnalyzer{}
+	for _, path := range paths {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		policy := Policy{}
+		err = yaml.Unmarshal(bs, &policy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the policy %s", path)
+		}
+		for _, rule := range policy.Rules {
+			err := rule.compile()
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid rule in the policy %s", path)
+			}
+		}
+		analyzer.Rules = append(analyzer.Rules, policy.Rules...)
+	}
+	return analyzer, nil
+}
+
+func (r *PolicyRule) compile() error {
+	if r.Name == "" {
+		return errors.New("rule without name")
+	}
+	if r.Severity == "" {
+		r.Severity = SeverityMedium
+	}
+	if _, err := ParseSeverity(string(r.Severity)); err != nil {
+		return errors.Wrapf(err, "rule %s", r.Name)
+	}
+	r.pathRegexps = make([]*regexp.Regexp, 0, len(r.Paths))
+	for _, path := range r.Paths {
+		re, err := regexp.Compile(path)
+		if err != nil {
+			return errors.Wrapf(err, "rule %s", r.Name)
+		}
+		r.pathRegexps = append(r.pathRegexps, re)
+	}
+	expr, err := syntax.ParseExpr(r.Name, r.Expr, 0)
+	if err != nil {
+		return errors.Wrapf(err, "rule %s", r.Name)
+	}
+	r.expr = expr
+	return nil
+}
+
+func (r *PolicyRule) match(dir string, res *Resource) bool {
+	if len(r.Kinds) > 0 {
+		found := false
+		for _, kind := range r.Kinds {
+			if kind == res.ID.Kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.pathRegexps) > 0 {
+		for _, re := range r.pathRegexps {
+			if re.MatchString(dir) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func (a *PolicyAnalyzer) Name() string {
+	return "policy"
+}
+
+func (a *PolicyAnalyzer) Title() string {
+	return "Policy Violations"
+}
+
+func (a *PolicyAnalyzer) Analyze(base, target []*Resource) ([]*Finding, error) {
+	return a.AnalyzeDir(".", base, target)
+}
+
+func (a *PolicyAnalyzer) AnalyzeDir(dir string, base, target []*Resource) ([]*Finding, error) {
+	baseMap := resourceMap(base)
+	findings := make([]*Finding, 0)
+	thread := &starlark.Thread{Name: "policy"}
+	for _, res := range target {
+		for _, rule := range a.Rules {
+			if !rule.match(dir, res) {
+				continue
+			}
+			env := starlark.StringDict{
+				"resource": starlarkValue(res.Object),
+				"base":     starlark.None,
+				"dir":      starlark.String(dir),
+			}
+			if baseRes, ok := baseMap[res.ID]; ok {
+				env["base"] = starlarkValue(baseRes.Object)
+			}
+			// An evaluation error of a rule on a resource is reported as a
+			// violation not to hide the other rules and resources.
+			var message string
+			value, err := starlark.EvalExpr(thread, rule.expr, env)
+			if err != nil {
+				message = fmt.Sprintf("evaluation failed: %v", err)
+			} else if value.Truth() {
+				continue
+			} else {
+				message = rule.Message
+				if message == "" {
+					message = fmt.Sprintf("`%s` is not satisfied", rule.Expr)
+				}
+			}
+			findings = append(findings, &Finding{
+				Severity: rule.Severity,
+				ID:       res.ID,
+				Message:  fmt.Sprintf("%s: %s", rule.Name, message),
+			})
+		}
+	}
+	return findings, nil
+}
+
+// starlarkValue converts a decoded JSON value into a Starlark value.
+func starlarkValue(value interface{}) starlark.Value {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None
+	case bool:
+		return starlark.Bool(v)
+	case string:
+		return starlark.String(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(n)
+		}
+		f, _ := v.Float64()
+		return starlark.Float(f)
+	case []interface{}:
+		elems := make([]starlark.Value, 0, len(v))
+		for _, elem := range v {
+			elems = append(elems, starlarkValue(elem))
+		}
+		return starlark.NewList(elems)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(v))
+		for _, key := range keys {
+			_ = dict.SetKey(starlark.String(key), starlarkValue(v[key]))
+		}
+		return dict
+	default:
+		return starlark.String(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyAnalyzer(t *testing.T) {
+	analyzer, err := LoadPolicyAnalyzer(filepath.Join("fixtures", "policy", "policy.yaml"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	deployment := func(replicas, image string) string {
+		return `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: ` + replicas + `
+  template:
+    spec:
+      containers:
+      - name: app
+        image: ` + image + "\n"
+	}
+	base, target := parseTestBuilds(t, deployment("3", "registry.example.com/app:v1"), deployment("1", "docker.io/app:v2"))
+	findings, err := analyzer.AnalyzeDir("overlays/prod", base, target)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	id := target[0].ID
+	assert.Equal(t, []*Finding{
+		{Severity: SeverityMedium, ID: id, Message: "required-labels: the team label is required"},
+		{Severity: SeverityHigh, ID: id, Message: "registry-allowlist: `all([c['image'].startswith('registry.example.com/') for c in resource['spec']['template']['spec']['containers']])` is not satisfied"},
+		{Severity: SeverityMedium, ID: id, Message: "prod-replicas: at least 2 replicas are required in prod"},
+		{Severity: SeverityLow, ID: id, Message: "no-scale-down: replicas are decreased"},
+	}, findings)
+
+	findings, err = analyzer.AnalyzeDir("overlays/dev", nil, target)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Len(t, findings, 2)
+}
+
+func TestLoadPolicyAnalyzerError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kustomize-diff-test-policy-")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+	for _, policy := range []string{
+		"rules:\n- name: invalid\n  expr: \"resource[\"\n",
+		"rules:\n- name: invalid\n  severity: critical\n  expr: \"True\"\n",
+		"rules:\n- expr: \"True\"\n",
+	} {
+		path := filepath.Join(dir, "policy.yaml")
+		if !assert.NoError(t, ioutil.WriteFile(path, []byte(policy), 0644)) {
+			t.FailNow()
+		}
+		_, err = LoadPolicyAnalyzer(path)
+		assert.Error(t, err)
+	}
+
+	// The rules are evaluated even after a rule fails.
+	analyzer := &PolicyAnalyzer{Rules: []*PolicyRule{
+		{Name: "missing", Expr: "resource['spec']['replicas'] > 1"},
+		{Name: "name", Severity: SeverityLow, Expr: "resource['metadata']['name'] == 'other'"},
+	}}
+	for _, rule := range analyzer.Rules {
+		if !assert.NoError(t, rule.compile()) {
+			t.FailNow()
+		}
+	}
+	_, target := parseTestBuilds(t, "", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: config\n")
+	findings := analyzeTestBuilds(t, analyzer, nil, target)
+	assert.Equal(t, []*Finding{
+		{Severity: SeverityMedium, ID: target[0].ID, Message: "missing: evaluation failed: key \"spec\" not in dict"},
+		{Severity: SeverityLow, ID: target[0].ID, Message: "name: `resource['metadata']['name'] == 'other'` is not satisfied"},
+	}, findings)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier float64
+}{
+	// The binary suffixes go first not to be taken as the decimal ones.
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"Pi", 1 << 50},
+	{"Ei", 1 << 60},
+	{"n", 1e-9},
+	{"u", 1e-6},
+	{"m", 1e-3},
+	{"k", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+	{"P", 1e15},
+	{"E", 1e18},
+}
+
+// ParseQuantity parses a Kubernetes quantity such as `500m` or `1Gi`.
+func ParseQuantity(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	multiplier := 1.0
+	for _, suffix := range quantitySuffixes {
+		if strings.HasSuffix(s, suffix.suffix) {
+			s = strings.TrimSuffix(s, suffix.suffix)
+			multiplier = suffix.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid quantity: %q", s)
+	}
+	return value * multiplier, nil
+}
+
+// FormatCPU formats millicores in cores if possible.
+func FormatCPU(millicores int64) string {
+	if millicores%1000 == 0 {
+		return strconv.FormatInt(millicores/1000, 10)
+	}
+	return fmt.Sprintf("%dm", millicores)
+}
+
+// FormatMemory formats bytes in the largest binary unit with at most 2
+// decimal places.
+func FormatMemory(bytes int64) string {
+	abs := math.Abs(float64(bytes))
+	for _, unit := range []struct {
+		suffix string
+		size   float64
+	}{{"Ti", 1 << 40}, {"Gi", 1 << 30}, {"Mi", 1 << 20}, {"Ki", 1 << 10}} {
+		if abs >= unit.size {
+			value := strconv.FormatFloat(float64(bytes)/unit.size, 'f', 2, 64)
+			return strings.TrimRight(strings.TrimRight(value, "0"), ".") + unit.suffix
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// escalatingVerbs are the verbs which let the subject gain more permissions.
+var escalatingVerbs = map[string]struct{}{
+	"*":           {},
+	"escalate":    {},
+	"bind":        {},
+	"impersonate": {},
+}
+
+// rbacPermission is a verb allowed on a resource. Namespace is empty for the
+// cluster-wide permissions.
+type rbacPermission struct {
+	Namespace string
+	Resource  string
+	Name      string
+	Verb      string
+}
+
+func (p rbacPermission) escalating() bool {
+	if _, ok := escalatingVerbs[p.Verb]; ok {
+		return true
+	}
+	return strings.Contains(p.Resource, "*") || strings.SplitN(p.Resource, "/", 2)[0] == "secrets"
+}
+
+// rbacGrants are the permissions and the roles bound to the subjects.
+type rbacGrants struct {
+	permissions map[ResourceID]map[rbacPermission]struct{}
+	// roles are the roles bound to the subjects which are not in the build,
+	// such as the default ClusterRoles.
+	roles map[ResourceID][]string
+}
+
+// RBACAnalyzer lists the permissions gained or lost by the subjects of the
+// role bindings.
+type RBACAnalyzer struct{}
+
+func (a *RBACAnalyzer) Name() string {
+	return "rbac"
+}
+
+func (a *RBACAnalyzer) Title() string {
+	return "RBAC Changes"
+}
+
+func (a *RBACAnalyzer) Analyze(base, target []*Resource) ([]*Finding, error) {
+	baseGrants := newRBACGrants(base)
+	targetGrants := newRBACGrants(target)
+	subjects := map[ResourceID]struct{}{}
+	for _, grants := range []*rbacGrants{baseGrants, targetGrants} {
+		for subject := range grants.permissions {
+			subjects[subject] = struct{}{}
+		}
+		for subject := range grants.roles {
+			subjects[subject] = struct{}{}
+		}
+	}
+	sortedSubjects := make([]ResourceID, 0, len(subjects))
+	for subject := range subjects {
+		sortedSubjects = append(sortedSubjects, subject)
+	}
+	sort.Slice(sortedSubjects, func(i, j int) bool {
+		return sortedSubjects[i].String() < sortedSubjects[j].String()
+	})
+
+	findings := make([]*Finding, 0)
+	for _, subject := range sortedSubjects {
+		for _, role := range stringsDifference(targetGrants.roles[subject], baseGrants.roles[subject]) {
+			finding := &Finding{ID: subject}
+			if role == "ClusterRole `cluster-admin`" {
+				finding.Severity = SeverityHigh
+				finding.Message = fmt.Sprintf("is bound to %s", role)
+			} else {
+				finding.Severity = SeverityMedium
+				finding.Message = fmt.Sprintf("is bound to %s, which is not in the build", role)
+			}
+			findings = append(findings, finding)
+		}
+		findings = append(findings, permissionFindings(subject, "gains", permissionDifference(targetGrants.permissions[subject], baseGrants.permissions[subject]))...)
+		findings = append(findings, permissionFindings(subject, "loses", permissionDifference(baseGrants.permissions[subject], targetGrants.permissions[subject]))...)
+	}
+	return findings, nil
+}
+
+func newRBACGrants(resources []*Resource) *rbacGrants {
+	grants := &rbacGrants{
+		permissions: map[ResourceID]map[rbacPermission]struct{}{},
+		roles:       map[ResourceID][]string{},
+	}
+	roles := map[ResourceID]*Resource{}
+	for _, res := range resources {
+		if res.ID.Kind == "Role" || res.ID.Kind == "ClusterRole" {
+			roles[ResourceID{Kind: res.ID.Kind, Namespace: res.ID.Namespace, Name: res.ID.Name}] = res
+		}
+	}
+	for _, res := range resources {
+		if res.ID.Kind != "RoleBinding" && res.ID.Kind != "ClusterRoleBinding" {
+			continue
+		}
+		roleKind, _ := res.Field("roleRef.kind")
+		roleName, _ := res.Field("roleRef.name")
+		roleID := ResourceID{Kind: fmt.Sprint(roleKind), Name: fmt.Sprint(roleName)}
+		if roleID.Kind == "Role" {
+			roleID.Namespace = res.ID.Namespace
+		}
+		// RoleBindings grant the permissions only in their namespace.
+		namespace := ""
+		if res.ID.Kind == "RoleBinding" {
+			namespace = res.ID.Namespace
+		}
+		for _, subject := range fieldList(res, "subjects") {
+			subjectID := rbacSubject(subject, res.ID.Namespace)
+			role, ok := roles[roleID]
+			if !ok {
+				grants.roles[subjectID] = append(grants.roles[subjectID], fmt.Sprintf("%s `%s`", roleID.Kind, roleID.Name))
+				if roleID.Kind == "ClusterRole" && roleID.Name == "cluster-admin" {
+					grants.add(subjectID, rbacPermission{Namespace: namespace, Resource: "*.*", Verb: "*"})
+				}
+				continue
+			}
+			for _, rule := range fieldList(role, "rules") {
+				for _, permission := range rulePermissions(rule, namespace) {
+					grants.add(subjectID, permission)
+				}
+			}
+		}
+	}
+	return grants
+}
+
+func (g *rbacGrants) add(subject ResourceID, permission rbacPermission) {
+	if g.permissions[subject] == nil {
+		g.permissions[subject] = map[rbacPermission]struct{}{}
+	}
+	g.permissions[subject][permission] = struct{}{}
+}
+
+func rbacSubject(subject interface{}, namespace string) ResourceID {
+	kind, _ := lookupField(subject, "kind")
+	name, _ := lookupField(subject, "name")
+	id := ResourceID{Kind: fmt.Sprint(kind), Name: fmt.Sprint(name)}
+	if id.Kind == "ServiceAccount" {
+		id.Namespace = namespace
+		if ns, ok := lookupField(subject, "namespace"); ok {
+			id.Namespace = fmt.Sprint(ns)
+		}
+	}
+	return id
+}
+
+// rulePermissions expands a policy rule into the permissions.
+func rulePermissions(rule interface{}, namespace string) []rbacPermission {
+	verbs := stringList(rule, "verbs")
+	resources := make([]string, 0)
+	for _, group := range stringList(rule, "apiGroups") {
+		for _, resource := range stringList(rule, "resources") {
+			if group != "" {
+				resource = fmt.Sprintf("%s.%s", resource, group)
+			}
+			resources = append(resources, resource)
+		}
+	}
+	names := stringList(rule, "resourceNames")
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	permissions := make([]rbacPermission, 0)
+	for _, verb := range verbs {
+		for _, resource := range resources {
+			for _, name := range names {
+				permissions = append(permissions, rbacPermission{Namespace: namespace, Resource: resource, Name: name, Verb: verb})
+			}
+		}
+		// The non-resource URLs are cluster-wide.
+		for _, url := range stringList(rule, "nonResourceURLs") {
+			permissions = append(permissions, rbacPermission{Resource: url, Verb: verb})
+		}
+	}
+	return permissions
+}
+
+// permissionFindings groups the permissions by the resource to make a finding
+// per resource.
+func permissionFindings(subject ResourceID, action string, permissions []rbacPermission) []*Finding {
+	type resourceKey struct {
+		Namespace string
+		Resource  string
+		Name      string
+	}
+	verbs := map[resourceKey][]string{}
+	escalating := map[resourceKey]bool{}
+	keys := make([]resourceKey, 0)
+	for _, permission := range permissions {
+		key := resourceKey{permission.Namespace, permission.Resource, permission.Name}
+		if _, ok := verbs[key]; !ok {
+			keys = append(keys, key)
+		}
+		verbs[key] = append(verbs[key], fmt.Sprintf("`%s`", permission.Verb))
+		escalating[key] = escalating[key] || permission.escalating()
+	}
+	findings := make([]*Finding, 0, len(keys))
+	for _, key := range keys {
+		severity := SeverityLow
+		if action == "gains" {
+			severity = SeverityMedium
+			if escalating[key] {
+				severity = SeverityHigh
+			}
+		}
+		target := fmt.Sprintf("`%s`", key.Resource)
+		if key.Name != "" {
+			target += fmt.Sprintf(" named `%s`", key.Name)
+		}
+		scope := "cluster-wide"
+		if key.Namespace != "" {
+			scope = fmt.Sprintf("in namespace `%s`", key.Namespace)
+		}
+		findings = append(findings, &Finding{
+			Severity: severity,
+			ID:       subject,
+			Message:  fmt.Sprintf("%s %s on %s %s", action, strings.Join(verbs[key], ", "), target, scope),
+		})
+	}
+	return findings
+}
+
+// permissionDifference returns the sorted permissions in a but not in b.
+func permissionDifference(a, b map[rbacPermission]struct{}) []rbacPermission {
+	diff := make([]rbacPermission, 0)
+	for permission := range a {
+		if _, ok := b[permission]; !ok {
+			diff = append(diff, permission)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		x, y := diff[i], diff[j]
+		if x.Namespace != y.Namespace {
+			return x.Namespace < y.Namespace
+		}
+		if x.Resource != y.Resource {
+			return x.Resource < y.Resource
+		}
+		if x.Name != y.Name {
+			return x.Name < y.Name
+		}
+		return x.Verb < y.Verb
+	})
+	return diff
+}
+
+func stringList(obj interface{}, path string) []string {
+	value, _ := lookupField(obj, path)
+	list, _ := value.([]interface{})
+	strs := make([]string, 0, len(list))
+	for _, elem := range list {
+		strs = append(strs, fmt.Sprint(elem))
+	}
+	return strs
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRBACAnalyzer(t *testing.T) {
+	baseYaml := `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: reader
+  namespace: app
+rules:
+- apiGroups: [""]
+  resources: ["configmaps"]
+  verbs: ["get", "list"]
+- apiGroups: ["apps"]
+  resources: ["deployments"]
+  verbs: ["get"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: reader
+  namespace: app
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: reader
+subjects:
+- kind: ServiceAccount
+  name: app
+`
+	targetYaml := `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: reader
+  namespace: app
+rules:
+- apiGroups: [""]
+  resources: ["configmaps", "secrets"]
+  verbs: ["get", "list"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: reader
+  namespace: app
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: reader
+subjects:
+- kind: ServiceAccount
+  name: app
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: admins
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: Group
+  name: admins
+  apiGroup: rbac.authorization.k8s.io
+`
+	base, target := parseTestBuilds(t, baseYaml, targetYaml)
+	findings := analyzeTestBuilds(t, &RBACAnalyzer{}, base, target)
+	assert.Equal(t, []*Finding{
+		{
+			Severity: SeverityHigh,
+			ID:       ResourceID{Kind: "Group", Name: "admins"},
+			Message:  "is bound to ClusterRole `cluster-admin`",
+		},
+		{
+			Severity: SeverityHigh,
+			ID:       ResourceID{Kind: "Group", Name: "admins"},
+			Message:  "gains `*` on `*.*` cluster-wide",
+		},
+		{
+			Severity: SeverityHigh,
+			ID:       ResourceID{Kind: "ServiceAccount", Namespace: "app", Name: "app"},
+			Message:  "gains `get`, `list` on `secrets` in namespace `app`",
+		},
+		{
+			Severity: SeverityLow,
+			ID:       ResourceID{Kind: "ServiceAccount", Namespace: "app", Name: "app"},
+			Message:  "loses `get` on `deployments.apps` in namespace `app`",
+		},
+	}, findings)
+}
+
+func TestRBACAnalyzerClusterRole(t *testing.T) {
+	clusterRole := func(verbs string) string {
+		return `apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: pod-reader
+rules:
+- apiGroups: [""]
+  resources: ["pods"]
+  resourceNames: ["app"]
+  verbs: ` + verbs + `
+- nonResourceURLs: ["/healthz"]
+  verbs: ["get"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: pod-reader
+  namespace: app
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: pod-reader
+subjects:
+- kind: User
+  name: alice
+- kind: ServiceAccount
+  name: view
+  namespace: other
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: view
+roleRef:
+  kind: ClusterRole
+  name: view
+subjects:
+- kind: User
+  name: alice
+`
+	}
+	base, target := parseTestBuilds(t, clusterRole(`["get"]`), clusterRole(`["get", "delete"]`))
+	findings := analyzeTestBuilds(t, &RBACAnalyzer{}, base, target)
+	assert.Equal(t, []*Finding{
+		{
+			Severity: SeverityMedium,
+			ID:       ResourceID{Kind: "ServiceAccount", Namespace: "other", Name: "view"},
+			Message:  "gains `delete` on `pods` named `app` in namespace `app`",
+		},
+		{
+			Severity: SeverityMedium,
+			ID:       ResourceID{Kind: "User", Name: "alice"},
+			Message:  "gains `delete` on `pods` named `app` in namespace `app`",
+		},
+	}, findings)
+
+	findings = analyzeTestBuilds(t, &RBACAnalyzer{}, nil, base)
+	assert.Equal(t, []*Finding{
+		{
+			Severity: SeverityMedium,
+			ID:       ResourceID{Kind: "ServiceAccount", Namespace: "other", Name: "view"},
+			Message:  "gains `get` on `/healthz` cluster-wide",
+		},
+		{
+			Severity: SeverityMedium,
+			ID:       ResourceID{Kind: "ServiceAccount", Namespace: "other", Name: "view"},
+			Message:  "gains `get` on `pods` named `app` in namespace `app`",
+		},
+		{
+			Severity: SeverityMedium,
+			ID:       ResourceID{Kind: "User", Name: "alice"},
+			Message:  "is bound to ClusterRole `view`, which is not in the build",
+		},
+		{
+			Severity: SeverityMedium,
+			ID:       ResourceID{Kind: "User", Name: "alice"},
+			Message:  "gains `get` on `/healthz` cluster-wide",
+		},
+		{
+			Severity: SeverityMedium,
+			ID:       ResourceID{Kind: "User", Name: "alice"},
+			Message:  "gains `get` on `pods` named `app` in namespace `app`",
+		},
+	}, findings)
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// secretProviderPaths are the paths of the names of the Secrets generated by
+// the controllers of the kinds, which default to the names of the resources.
+var secretProviderPaths = map[string]string{
+	"SealedSecret":   "spec.template.metadata.name",
+	"ExternalSecret": "spec.target.name",
+}
+
+type referenceKey struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// ReferenceAnalyzer flags the references to the resources which are not in
+// the same build.
+type ReferenceAnalyzer struct{}
+
+func (a *ReferenceAnalyzer) Name() string {
+	return "reference"
+}
+
+func (a *ReferenceAnalyzer) Title() string {
+	return "Dangling References"
+}
+
+func (a *ReferenceAnalyzer) Analyze(base, target []*Resource) ([]*Finding, error) {
+	baseMessages := map[ResourceID]map[string]struct{}{}
+	for id, messages := range danglingReferences(base) {
+		baseMessages[id] = map[string]struct{}{}
+		for _, message := range messages {
+			baseMessages[id][message] = struct{}{}
+		}
+	}
+	targetMessages := danglingReferences(target)
+	findings := make([]*Finding, 0)
+	for _, res := range target {
+		for _, message := range targetMessages[res.ID] {
+			_, existing := baseMessages[res.ID][message]
+			findings = append(findings, &Finding{
+				Severity: SeverityMedium,
+				ID:       res.ID,
+				Message:  message,
+				Existing: existing,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func danglingReferences(resources []*Resource) map[ResourceID][]string {
+	found := map[referenceKey]struct{}{}
+	podLabels := map[string][]map[string]interface{}{}
+	for _, res := range resources {
+		found[referenceKey{res.ID.Kind, res.ID.Namespace, res.ID.Name}] = struct{}{}
+		if path, ok := secretProviderPaths[res.ID.Kind]; ok {
+			name := res.ID.Name
+			if value, ok := res.Field(path); ok {
+				name = fmt.Sprint(value)
+			}
+			found[referenceKey{"Secret", res.ID.Namespace, name}] = struct{}{}
+		}
+		if path, ok := podSpecPaths[res.ID.Kind]; ok {
+			metadataPath := strings.TrimSuffix(path, "spec") + "metadata.labels"
+			labels, _ := lookupField(res.Object, metadataPath)
+			if m, ok := labels.(map[string]interface{}); ok {
+				podLabels[res.ID.Namespace] = append(podLabels[res.ID.Namespace], m)
+			}
+		}
+	}
+
+	messages := map[ResourceID][]string{}
+	for _, res := range resources {
+		refs := make([]reference, 0)
+		if path, ok := podSpecPaths[res.ID.Kind]; ok {
+			podSpec, _ := res.Field(path)
+			refs = podSpecReferences(podSpec)
+		}
+		switch res.ID.Kind {
+		case "Service":
+			if message := serviceSelectorMessage(res, podLabels[res.ID.Namespace]); message != "" {
+				messages[res.ID] = append(messages[res.ID], message)
+			}
+		case "Ingress":
+			refs = ingressReferences(res)
+		}
+		for _, ref := range refs {
+			if _, ok := found[referenceKey{ref.kind, res.ID.Namespace, ref.name}]; ok {
+				continue
+			}
+			messages[res.ID] = append(messages[res.ID], fmt.Sprintf("%s `%s` referenced by `%s` is not in the build", ref.kind, ref.name, ref.field))
+		}
+	}
+	return messages
+}
+
+type reference struct {
+	kind  string
+	name  string
+	field string
+}
+
+func podSpecReferences(podSpec interface{}) []reference {
+	refs := make([]reference, 0)
+	add := func(kind string, obj interface{}, path, field string) {
+		if isTrue(obj, "optional") {
+			return
+		}
+		name, ok := lookupField(obj, path)
+		if !ok || fmt.Sprint(name) == "" {
+			return
+		}
+		refs = append(refs, reference{kind, fmt.Sprint(name), field})
+	}
+	for _, path := range []string{"serviceAccountName", "serviceAccount"} {
+		if name, ok := lookupField(podSpec, path); ok && fmt.Sprint(name) != "default" {
+			refs = append(refs, reference{"ServiceAccount", fmt.Sprint(name), path})
+			break
+		}
+	}
+	value, _ := lookupField(podSpec, "imagePullSecrets")
+	list, _ := value.([]interface{})
+	for _, secret := range list {
+		add("Secret", secret, "name", "imagePullSecrets")
+	}
+	value, _ = lookupField(podSpec, "volumes")
+	list, _ = value.([]interface{})
+	for _, volume := range list {
+		if configMap, ok := lookupField(volume, "configMap"); ok {
+			add("ConfigMap", configMap, "name", "volumes")
+		}
+		if secret, ok := lookupField(volume, "secret"); ok {
+			add("Secret", secret, "secretName", "volumes")
+		}
+		if claim, ok := lookupField(volume, "persistentVolumeClaim"); ok {
+			add("PersistentVolumeClaim", claim, "claimName", "volumes")
+		}
+		sources, _ := lookupField(volume, "projected.sources")
+		sourceList, _ := sources.([]interface{})
+		for _, source := range sourceList {
+			if configMap, ok := lookupField(source, "configMap"); ok {
+				add("ConfigMap", configMap, "name", "volumes")
+			}
+			if secret, ok := lookupField(source, "secret"); ok {
+				add("Secret", secret, "name", "volumes")
+			}
+		}
+	}
+	for _, container := range podContainers(podSpec) {
+		value, _ := lookupField(container, "envFrom")
+		list, _ := value.([]interface{})
+		for _, envFrom := range list {
+			if configMap, ok := lookupField(envFrom, "configMapRef"); ok {
+				add("ConfigMap", configMap, "name", "envFrom")
+			}
+			if secret, ok := lookupField(envFrom, "secretRef"); ok {
+				add("Secret", secret, "name", "envFrom")
+			}
+		}
+		value, _ = lookupField(container, "env")
+		list, _ = value.([]interface{})
+		for _, env := range list {
+			if configMap, ok := lookupField(env, "valueFrom.configMapKeyRef"); ok {
+				add("ConfigMap", configMap, "name", "env")
+			}
+			if secret, ok := lookupField(env, "valueFrom.secretKeyRef"); ok {
+				add("Secret", secret, "name", "env")
+			}
+		}
+	}
+	return uniqueReferences(refs)
+}
+
+func ingressReferences(res *Resource) []reference {
+	backends := make([]interface{}, 0)
+	for _, path := range []string{"spec.defaultBackend", "spec.backend"} {
+		if backend, ok := res.Field(path); ok {
+			backends = append(backends, backend)
+		}
+	}
+	for _, rule := range fieldList(res, "spec.rules") {
+		paths, _ := lookupField(rule, "http.paths")
+		list, _ := paths.([]interface{})
+		for _, path := range list {
+			if backend, ok := lookupField(path, "backend"); ok {
+				backends = append(backends, backend)
+			}
+		}
+	}
+	refs := make([]reference, 0)
+	for _, backend := range backends {
+		// networking.k8s.io/v1 and the older versions.
+		for _, path := range []string{"service.name", "serviceName"} {
+			if name, ok := lookupField(backend, path); ok {
+				refs = append(refs, reference{"Service", fmt.Sprint(name), "backend"})
+			}
+		}
+	}
+	return uniqueReferences(refs)
+}
+
+func serviceSelectorMessage(res *Resource, podLabels []map[string]interface{}) string {
+	if optionalFieldString(res, "spec.type") == "ExternalName" {
+		return ""
+	}
+	value, _ := res.Field("spec.selector")
+	selector, _ := value.(map[string]interface{})
+	if len(selector) == 0 {
+		return ""
+	}
+	for _, labels := range podLabels {
+		matched := true
+		for key, value := range selector {
+			if labels[key] != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return ""
+		}
+	}
+	keys := make([]string, 0, len(selector))
+	for key := range selector {
+		keys = append(keys, fmt.Sprintf("%s=%v", key, selector[key]))
+	}
+	sort.Strings(keys)
+	return fmt.Sprintf("selector `%s` matches no pod template in the build", strings.Join(keys, ","))
+}
+
+func uniqueReferences(refs []reference) []reference {
+	seen := map[reference]struct{}{}
+	unique := make([]reference, 0, len(refs))
+	for _, ref := range refs {
+		if _, ok := seen[ref]; ok {
+			continue
+		}
+		seen[ref] = struct{}{}
+		unique = append(unique, ref)
+	}
+	return unique
+}
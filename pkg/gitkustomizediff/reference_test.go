@@ -0,0 +1,136 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReferenceAnalyzer(t *testing.T) {
+	baseYaml := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-abc
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      serviceAccountName: app
+      containers:
+      - name: app
+        envFrom:
+        - configMapRef:
+            name: config-abc
+`
+	targetYaml := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-def
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    metadata:
+      labels:
+        app: app
+    spec:
+      serviceAccountName: app
+      containers:
+      - name: app
+        envFrom:
+        - configMapRef:
+            name: config-abc
+        env:
+        - name: PASSWORD
+          valueFrom:
+            secretKeyRef:
+              name: password
+        - name: TOKEN
+          valueFrom:
+            secretKeyRef:
+              name: token
+              optional: true
+      volumes:
+      - name: data
+        persistentVolumeClaim:
+          claimName: data
+      - name: tls
+        secret:
+          secretName: tls
+---
+apiVersion: bitnami.com/v1alpha1
+kind: SealedSecret
+metadata:
+  name: password
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  selector:
+    app: app
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+spec:
+  selector:
+    app: web
+---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: app
+spec:
+  rules:
+  - http:
+      paths:
+      - path: /
+        backend:
+          service:
+            name: app
+      - path: /api
+        backend:
+          service:
+            name: api
+`
+	base, target := parseTestBuilds(t, baseYaml, targetYaml)
+	findings := analyzeTestBuilds(t, &ReferenceAnalyzer{}, base, target)
+	deployment := ResourceID{Group: "apps", Kind: "Deployment", Name: "app"}
+	assert.Equal(t, []*Finding{
+		{Severity: SeverityMedium, ID: deployment, Message: "ServiceAccount `app` referenced by `serviceAccountName` is not in the build", Existing: true},
+		{Severity: SeverityMedium, ID: deployment, Message: "PersistentVolumeClaim `data` referenced by `volumes` is not in the build"},
+		{Severity: SeverityMedium, ID: deployment, Message: "Secret `tls` referenced by `volumes` is not in the build"},
+		{Severity: SeverityMedium, ID: deployment, Message: "ConfigMap `config-abc` referenced by `envFrom` is not in the build"},
+		{Severity: SeverityMedium, ID: ResourceID{Kind: "Service", Name: "web"}, Message: "selector `app=web` matches no pod template in the build"},
+		{Severity: SeverityMedium, ID: ResourceID{Group: "networking.k8s.io", Kind: "Ingress", Name: "app"}, Message: "Service `api` referenced by `backend` is not in the build"},
+	}, findings)
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+type ResourceID struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (id ResourceID) String() string {
+	kind := id.Kind
+	if id.Group != "" {
+		kind = fmt.Sprintf("%s.%s", id.Kind, id.Group)
+	}
+	if id.Namespace == "" {
+		return fmt.Sprintf("%s/%s", kind, id.Name)
+	}
+	return fmt.Sprintf("%s/%s/%s", kind, id.Namespace, id.Name)
+}
+
+func newResourceID(node *yaml.RNode) ResourceID {
+	apiVersion := node.GetApiVersion()
+	group := ""
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		group = apiVersion[:i]
+	}
+	return ResourceID{
+		Group:     group,
+		Kind:      node.GetKind(),
+		Namespace: node.GetNamespace(),
+		Name:      node.GetName(),
+	}
+}
+
+type Resource struct {
+	ID         ResourceID
+	APIVersion string
+	Yaml       string
+	Object     map[string]interface{}
+}
+
+func ParseResources(text string) ([]*Resource, error) {
+	nodes, err := kio.FromBytes([]byte(text))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resources := make([]*Resource, 0, len(nodes))
+	for _, node := range nodes {
+		res, err := NewResource(node)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+func NewResource(node *yaml.RNode) (*Resource, error) {
+	s, err := node.String()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	bs, err := node.MarshalJSON()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	obj := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	err = decoder.Decode(&obj)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &Resource{
+		ID:         newResourceID(node),
+		APIVersion: node.GetApiVersion(),
+		Yaml:       s,
+		Object:     obj,
+	}, nil
+}
+
+type ResourceDiffType string
+
+const (
+	ResourceAdded   ResourceDiffType = "added"
+	ResourceRemoved ResourceDiffType = "removed"
+	ResourceChanged ResourceDiffType = "changed"
+)
+
+type ResourceDiff struct {
+	ID      ResourceID
+	Type    ResourceDiffType
+	Content string
+}
+
+type ResourceDiffOpts struct {
+	IgnoreNamespace    bool
+	IgnoreNamePrefixes []string
+	IgnoreNameSuffixes []string
+}
+
+func (opts ResourceDiffOpts) normalize(res *Resource) (*Resource, error) {
+	if !opts.IgnoreNamespace && len(opts.IgnoreNamePrefixes) == 0 && len(opts.IgnoreNameSuffixes) == 0 {
+		return res, nil
+	}
+	node, err := yaml.Parse(res.Yaml)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if opts.IgnoreNamespace {
+		err = node.PipeE(yaml.Lookup("metadata"), yaml.Clear("namespace"))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	name := node.GetName()
+	for _, prefix := range opts.IgnoreNamePrefixes {
+		if prefix != "" && strings.HasPrefix(name, prefix) {
+			name = strings.TrimPrefix(name, prefix)
+			break
+		}
+	}
+	for _, suffix := range opts.IgnoreNameSuffixes {
+		if suffix != "" && strings.HasSuffix(name, suffix) {
+			name = strings.TrimSuffix(name, suffix)
+			break
+		}
+	}
+	if name != node.GetName() {
+		err = node.SetName(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return NewResource(node)
+}
+
+// normalizeAll normalizes the resources by their IDs. Resources which collide
+// after the normalization are an error as one would hide the other.
+func (opts ResourceDiffOpts) normalizeAll(resources []*Resource) (map[ResourceID]*Resource, error) {
+	normalizedMap := map[ResourceID]*Resource{}
+	originalIDs := map[ResourceID]ResourceID{}
+	for _, res := range resources {
+		normalized, err := opts.normalize(res)
+		if err != nil {
+			return nil, err
+		}
+		if id, ok := originalIDs[normalized.ID]; ok {
+			return nil, errors.Errorf("%s and %s collide as %s after ignoring the namespaces and the name affixes", id, res.ID, normalized.ID)
+		}
+		originalIDs[normalized.ID] = res.ID
+		normalizedMap[normalized.ID] = normalized
+	}
+	return normalizedMap, nil
+}
+
+func DiffResources(baseResources, targetResources []*Resource, opts ResourceDiffOpts) ([]*ResourceDiff, error) {
+	baseMap, err := opts.normalizeAll(baseResources)
+	if err != nil {
+		return nil, err
+	}
+	targetMap, err := opts.normalizeAll(targetResources)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]ResourceID, 0, len(baseMap)+len(targetMap))
+	for id := range baseMap {
+		ids = append(ids, id)
+	}
+	for id := range targetMap {
+		if _, ok := baseMap[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+
+	diffs := make([]*ResourceDiff, 0)
+	for _, id := range ids {
+		baseYaml := ""
+		targetYaml := ""
+		diffType := ResourceChanged
+		if res, ok := baseMap[id]; ok {
+			baseYaml = res.Yaml
+		} else {
+			diffType = ResourceAdded
+		}
+		if res, ok := targetMap[id]; ok {
+			targetYaml = res.Yaml
+		} else {
+			diffType = ResourceRemoved
+		}
+		content, err := utils.Diff(baseYaml, targetYaml)
+		if err != nil {
+			return nil, err
+		}
+		if content == "" {
+			continue
+		}
+		diffs = append(diffs, &ResourceDiff{
+			ID:      id,
+			Type:    diffType,
+			Content: content,
+		})
+	}
+	return diffs, nil
+}
+
+type ResourceSelector struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func (s ResourceSelector) Match(id ResourceID) bool {
+	if s.Group != "" && s.Group != id.Group {
+		return false
+	}
+	if s.Kind != "" && s.Kind != id.Kind {
+		return false
+	}
+	if s.Namespace != "" && s.Namespace != id.Namespace {
+		return false
+	}
+	if s.Name != "" && s.Name != id.Name {
+		return false
+	}
+	return true
+}
+
+var fieldPathSegmentRegexp = regexp.MustCompile(`^([^\[\]]*)((?:\[[^\[\]]+\])*)$`)
+var fieldPathIndexRegexp = regexp.MustCompile(`\[([^\[\]]+)\]`)
+
+// Field looks up a value by a dotted path such as
+// `spec.template.spec.containers[name=app].image` or `spec.ports[0].port`.
+func (r *Resource) Field(path string) (interface{}, bool) {
+	return lookupField(r.Object, path)
+}
+
+func lookupField(obj interface{}, path string) (interface{}, bool) {
+	current := obj
+	for _, segment := range strings.Split(path, ".") {
+		m := fieldPathSegmentRegexp.FindStringSubmatch(segment)
+		if m == nil {
+			return nil, false
+		}
+		if m[1] != "" {
+			mapValue, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			current, ok = mapValue[m[1]]
+			if !ok {
+				return nil, false
+			}
+		}
+		for _, index := range fieldPathIndexRegexp.FindAllStringSubmatch(m[2], -1) {
+			listValue, ok := current.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			if kv := strings.SplitN(index[1], "=", 2); len(kv) == 2 {
+				found := false
+				for _, elem := range listValue {
+					elemMap, ok := elem.(map[string]interface{})
+					if ok && fmt.Sprintf("%v", elemMap[kv[0]]) == kv[1] {
+						current = elem
+						found = true
+						break
+					}
+				}
+				if !found {
+					return nil, false
+				}
+			} else {
+				i, err := strconv.Atoi(index[1])
+				if err != nil || i < 0 || i >= len(listValue) {
+					return nil, false
+				}
+				current = listValue[i]
+			}
+		}
+	}
+	return current, true
+}
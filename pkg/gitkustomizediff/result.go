@@ -42,8 +42,19 @@ func (r *DiffError) Error() error {
 	return r.err
 }
 
+type ResourceSource struct {
+	ID   ResourceID
+	Type ResourceDiffType
+	// Files are the repo-relative paths of the files which produced or
+	// patched the resource. Remote files are in the form of repo//path?ref=ref.
+	Files []string
+}
+
 type DiffContent struct {
 	content string
+	// Sources are the source files of the changed resources, which are
+	// resolved only with the origins option.
+	Sources []*ResourceSource
 }
 
 func (r *DiffContent) ToString() string {
@@ -58,15 +69,48 @@ func (r *DiffContent) AsMarkdown() string {
 	}
 }
 
+type DiffUnchanged struct {
+}
+
+func (r *DiffUnchanged) ToString() string {
+	return ""
+}
+
+func (r *DiffUnchanged) AsMarkdown() string {
+	return ""
+}
+
 type DiffMap struct {
-	SrcDirs []string
-	DstDirs []string
-	Results map[string]DiffResult
+	SrcDirs      []string
+	DstDirs      []string
+	Results      map[string]DiffResult
+	RemoteInputs map[string][]string
+	// KustomizationFiles are the file names of the kustomizations on the
+	// target side by dir.
+	KustomizationFiles map[string]string
+	// Findings are the findings of the analyzers by dir.
+	Findings map[string][]*Finding
+	// AnalyzerErrors are the errors of the analyzers by dir.
+	AnalyzerErrors map[string][]*AnalyzerError
+	// ImageChanges are the image changes by dir.
+	ImageChanges map[string][]*ImageChange
+	// CapacityDeltas are the capacity changes by dir.
+	CapacityDeltas map[string][]*CapacityDelta
+	// IncludedDirs are the dirs included by the other kustomizations, whose
+	// capacity changes are counted by the including ones.
+	IncludedDirs map[string]struct{}
 }
 
 func NewDiffMap() *DiffMap {
 	return &DiffMap{
-		Results: make(map[string]DiffResult),
+		Results:            make(map[string]DiffResult),
+		RemoteInputs:       make(map[string][]string),
+		KustomizationFiles: make(map[string]string),
+		Findings:           make(map[string][]*Finding),
+		AnalyzerErrors:     make(map[string][]*AnalyzerError),
+		ImageChanges:       make(map[string][]*ImageChange),
+		CapacityDeltas:     make(map[string][]*CapacityDelta),
+		IncludedDirs:       make(map[string]struct{}),
 	}
 }
 
@@ -80,3 +124,77 @@ func (dm *DiffMap) Dirs() []string {
 	})
 	return paths
 }
+
+func (dm *DiffMap) ChangedDirs() []string {
+	paths := make([]string, 0)
+	for _, path := range dm.Dirs() {
+		if dm.Results[path].AsMarkdown() != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// AnalyzerFindings returns the findings of the analyzer sorted by dir.
+func (dm *DiffMap) AnalyzerFindings(analyzer string) []*Finding {
+	findings := make([]*Finding, 0)
+	for _, dir := range dm.Dirs() {
+		for _, finding := range dm.Findings[dir] {
+			if finding.Analyzer == analyzer {
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// HasFindings returns true if any new finding has the severity or a higher
+// one.
+func (dm *DiffMap) HasFindings(severity Severity) bool {
+	for _, findings := range dm.Findings {
+		for _, finding := range findings {
+			if !finding.Existing && finding.Severity.AtLeast(severity) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AllAnalyzerErrors returns the errors of the analyzers sorted by dir.
+func (dm *DiffMap) AllAnalyzerErrors() []*AnalyzerError {
+	analyzerErrors := make([]*AnalyzerError, 0)
+	for _, dir := range dm.Dirs() {
+		analyzerErrors = append(analyzerErrors, dm.AnalyzerErrors[dir]...)
+	}
+	return analyzerErrors
+}
+
+// CapacityDeltasByNamespace sums up the capacity changes of the dirs by
+// namespace. The dirs included by the other kustomizations are not counted
+// as the including ones count them.
+func (dm *DiffMap) CapacityDeltasByNamespace() []*CapacityDelta {
+	deltas := map[string]*CapacityDelta{}
+	for dir, dirDeltas := range dm.CapacityDeltas {
+		if _, ok := dm.IncludedDirs[dir]; ok {
+			continue
+		}
+		for _, delta := range dirDeltas {
+			total, ok := deltas[delta.Namespace]
+			if !ok {
+				total = &CapacityDelta{Namespace: delta.Namespace}
+				deltas[delta.Namespace] = total
+			}
+			total.Base = total.Base.Add(delta.Base)
+			total.Target = total.Target.Add(delta.Target)
+		}
+	}
+	res := make([]*CapacityDelta, 0, len(deltas))
+	for _, delta := range deltas {
+		res = append(res, delta)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Namespace < res[j].Namespace
+	})
+	return res
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"fmt"
+)
+
+// riskyDeletionKinds are the kinds whose deletion loses data or cascades to
+// other resources.
+var riskyDeletionKinds = map[string]struct{}{
+	"Namespace":                {},
+	"PersistentVolume":         {},
+	"PersistentVolumeClaim":    {},
+	"CustomResourceDefinition": {},
+	"StatefulSet":              {},
+}
+
+// immutableFields are the fields which can't be updated in place.
+var immutableFields = map[string][]string{
+	"Deployment":            {"spec.selector"},
+	"ReplicaSet":            {"spec.selector"},
+	"DaemonSet":             {"spec.selector"},
+	"StatefulSet":           {"spec.selector", "spec.serviceName", "spec.podManagementPolicy", "spec.volumeClaimTemplates"},
+	"Job":                   {"spec.selector", "spec.template", "spec.completionMode"},
+	"Service":               {"spec.clusterIP"},
+	"PersistentVolumeClaim": {"spec.accessModes", "spec.selector", "spec.volumeMode", "spec.volumeName"},
+	"StorageClass":          {"parameters", "reclaimPolicy", "volumeBindingMode"},
+}
+
+// storageClassFields are the fields which select the storage class.
+var storageClassFields = map[string]string{
+	"PersistentVolumeClaim": "spec.storageClassName",
+	"PersistentVolume":      "spec.storageClassName",
+	"StorageClass":          "provisioner",
+}
+
+// RiskAnalyzer flags the changes which lose data or fail to apply.
+type RiskAnalyzer struct{}
+
+func (a *RiskAnalyzer) Name() string {
+	return "risk"
+}
+
+func (a *RiskAnalyzer) Title() string {
+	return "Risky Changes"
+}
+
+func (a *RiskAnalyzer) Analyze(base, target []*Resource) ([]*Finding, error) {
+	targetMap := resourceMap(target)
+	findings := make([]*Finding, 0)
+	for _, baseRes := range base {
+		targetRes, ok := targetMap[baseRes.ID]
+		if !ok {
+			if _, ok := riskyDeletionKinds[baseRes.ID.Kind]; ok {
+				findings = append(findings, &Finding{
+					Severity: SeverityHigh,
+					ID:       baseRes.ID,
+					Message:  fmt.Sprintf("%s is deleted", baseRes.ID.Kind),
+				})
+			}
+			continue
+		}
+		if path, ok := storageClassFields[baseRes.ID.Kind]; ok && fieldChanged(baseRes, targetRes, path) {
+			findings = append(findings, &Finding{
+				Severity: SeverityHigh,
+				ID:       baseRes.ID,
+				Message:  fmt.Sprintf("storage class is changed by `%s` from %s to %s", path, valueString(baseRes.Field(path)), valueString(targetRes.Field(path))),
+			})
+		}
+		reportedPaths := map[string]struct{}{}
+		if baseRes.ID.Kind == "StatefulSet" {
+			templateFindings := volumeClaimTemplateFindings(baseRes, targetRes)
+			if len(templateFindings) > 0 {
+				reportedPaths["spec.volumeClaimTemplates"] = struct{}{}
+			}
+			findings = append(findings, templateFindings...)
+		}
+		for _, path := range immutableFields[baseRes.ID.Kind] {
+			if _, ok := reportedPaths[path]; ok {
+				continue
+			}
+			if baseRes.ID.Kind == "Service" {
+				// The cluster IP is allocated if it's not given.
+				if _, ok := targetRes.Field(path); !ok {
+					continue
+				}
+			}
+			if fieldChanged(baseRes, targetRes, path) {
+				findings = append(findings, &Finding{
+					Severity: SeverityMedium,
+					ID:       baseRes.ID,
+					Message:  fmt.Sprintf("immutable field `%s` is changed, which requires recreating the resource", path),
+				})
+			}
+		}
+	}
+	return findings, nil
+}
+
+func volumeClaimTemplateFindings(base, target *Resource) []*Finding {
+	findings := make([]*Finding, 0)
+	targetTemplates := map[string]interface{}{}
+	for _, targetTemplate := range fieldList(target, "spec.volumeClaimTemplates") {
+		if name, ok := lookupField(targetTemplate, "metadata.name"); ok {
+			targetTemplates[fmt.Sprint(name)] = targetTemplate
+		}
+	}
+	for _, baseTemplate := range fieldList(base, "spec.volumeClaimTemplates") {
+		name, ok := lookupField(baseTemplate, "metadata.name")
+		if !ok {
+			continue
+		}
+		targetTemplate, ok := targetTemplates[fmt.Sprint(name)]
+		if !ok {
+			continue
+		}
+		baseClass, baseOk := lookupField(baseTemplate, "spec.storageClassName")
+		targetClass, targetOk := lookupField(targetTemplate, "spec.storageClassName")
+		if baseOk != targetOk || fmt.Sprint(baseClass) != fmt.Sprint(targetClass) {
+			findings = append(findings, &Finding{
+				Severity: SeverityHigh,
+				ID:       base.ID,
+				Message:  fmt.Sprintf("storage class of the volume claim template `%v` is changed from %s to %s", name, valueString(baseClass, baseOk), valueString(targetClass, targetOk)),
+			})
+		}
+	}
+	return findings
+}
+
+func fieldList(res *Resource, path string) []interface{} {
+	value, _ := res.Field(path)
+	list, _ := value.([]interface{})
+	return list
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRiskAnalyzer(t *testing.T) {
+	baseYaml := `apiVersion: v1
+kind: Namespace
+metadata:
+  name: app
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: app
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: app
+spec:
+  selector:
+    matchLabels:
+      app: app
+  replicas: 1
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: app
+spec:
+  clusterIP: 10.0.0.1
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+  namespace: app
+spec:
+  storageClassName: standard
+`
+	targetYaml := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: app
+spec:
+  selector:
+    matchLabels:
+      app: app-v2
+  replicas: 2
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: app
+spec: {}
+---
+apiVersion: v1
+kind: PersistentVolumeClaim
+metadata:
+  name: data
+  namespace: app
+spec:
+  storageClassName: fast
+`
+	base, target := parseTestBuilds(t, baseYaml, targetYaml)
+	findings := analyzeTestBuilds(t, &RiskAnalyzer{}, base, target)
+	assert.Equal(t, []*Finding{
+		{
+			Severity: SeverityHigh,
+			ID:       ResourceID{Kind: "Namespace", Name: "app"},
+			Message:  "Namespace is deleted",
+		},
+		{
+			Severity: SeverityMedium,
+			ID:       ResourceID{Group: "apps", Kind: "Deployment", Namespace: "app", Name: "app"},
+			Message:  "immutable field `spec.selector` is changed, which requires recreating the resource",
+		},
+		{
+			Severity: SeverityHigh,
+			ID:       ResourceID{Kind: "PersistentVolumeClaim", Namespace: "app", Name: "data"},
+			Message:  "storage class is changed by `spec.storageClassName` from `standard` to `fast`",
+		},
+	}, findings)
+}
+
+func TestRiskAnalyzerStatefulSet(t *testing.T) {
+	statefulSet := func(storageClass, storage string) string {
+		return `apiVersion: apps/v1
+kind: StatefulSet
+metadata:
+  name: db
+spec:
+  volumeClaimTemplates:
+  - metadata:
+      name: data
+    spec:
+      storageClassName: ` + storageClass + `
+      resources:
+        requests:
+          storage: ` + storage + "\n"
+	}
+	// The storage class change isn't reported again as an immutable field change.
+	base, target := parseTestBuilds(t, statefulSet("standard", "1Gi"), statefulSet("fast", "1Gi"))
+	findings := analyzeTestBuilds(t, &RiskAnalyzer{}, base, target)
+	assert.Equal(t, []*Finding{
+		{
+			Severity: SeverityHigh,
+			ID:       base[0].ID,
+			Message:  "storage class of the volume claim template `data` is changed from `standard` to `fast`",
+		},
+	}, findings)
+
+	_, target = parseTestBuilds(t, "", statefulSet("standard", "2Gi"))
+	findings = analyzeTestBuilds(t, &RiskAnalyzer{}, base, target)
+	assert.Equal(t, []*Finding{
+		{
+			Severity: SeverityMedium,
+			ID:       base[0].ID,
+			Message:  "immutable field `spec.volumeClaimTemplates` is changed, which requires recreating the resource",
+		},
+	}, findings)
+
+	findings = analyzeTestBuilds(t, &RiskAnalyzer{}, base, nil)
+	assert.Equal(t, []*Finding{{Severity: SeverityHigh, ID: base[0].ID, Message: "StatefulSet is deleted"}}, findings)
+}
+
+func TestSeverity(t *testing.T) {
+	severity, err := ParseSeverity("medium")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.True(t, SeverityHigh.AtLeast(severity))
+	assert.True(t, SeverityMedium.AtLeast(severity))
+	assert.False(t, SeverityLow.AtLeast(severity))
+	_, err = ParseSeverity("critical")
+	assert.Error(t, err)
+}
@@ -17,121 +17,466 @@ limitations under the License.
 package gitkustomizediff
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+type Strategy string
+
+const (
+	StrategyMerge     Strategy = "merge"
+	StrategyMergeBase Strategy = "merge-base"
+	StrategyDirect    Strategy = "direct"
 )
 
 type RunOpts struct {
 	Base                    string
 	Target                  string
+	Remote                  string
 	IncludeRegexp           *regexp.Regexp
 	ExcludeRegexp           *regexp.Regexp
 	KustomizePath           string
 	KustomizeLoadRestrictor string
+	CacheDir                string
+	SkipUnchanged           bool
 	GitPath                 string
 	Debug                   bool
 	AllowDirty              bool
+	Staged                  bool
+	Strategy                Strategy
+	NoCheckout              bool
+	// GitDir is the path of a bare repo or a git dir to read the commits
+	// from. The dir path given to Run is regarded as a path in the tree.
+	GitDir  string
+	Fetch   bool
+	Origins bool
+	// RepoURL is the web URL of the repo to link the report to. It's
+	// inferred from the remote with the origins option.
+	RepoURL      string
+	RepoProvider RepoProvider
+	Analyzers    []Analyzer
+	Images       *ImageInventory
+	Capacity     bool
+}
+
+type SubmoduleChange struct {
+	Path      string
+	OldCommit string
+	NewCommit string
+	// Dirs are the changed kustomizations which read files in the submodule.
+	Dirs []string
 }
 
 type RunResult struct {
+	// BaseCommit is the full hash of the commit compared as base, which is
+	// the merge base with the merge-base strategy.
 	BaseCommit   string
 	TargetCommit string
-	DiffMap      *DiffMap
+	Base         *utils.CommitInfo
+	Target       *utils.CommitInfo
+	// MergeBase is nil if the commits have no common ancestor.
+	MergeBase        *utils.CommitInfo
+	DiffMap          *DiffMap
+	SubmoduleChanges []*SubmoduleChange
+	// Links is nil without a repo URL.
+	Links *RepoLinks
+}
+
+// SourceCommit returns the commit which has the source files of a resource
+// diff, which is the base commit for a removed resource.
+func (r *RunResult) SourceCommit(diffType ResourceDiffType) string {
+	if diffType == ResourceRemoved {
+		return r.BaseCommit
+	}
+	return r.TargetCommit
 }
 
 func Run(dirPath string, opts RunOpts) (*RunResult, error) {
 	log.Info("Start run")
 	currentGitDir := utils.NewGitDir(dirPath, opts.GitPath)
-	baseCommitish := opts.Base
-	if baseCommitish == "" {
-		baseCommitish = "origin/main"
-	}
-	baseCommit, err := currentGitDir.CommitHash(baseCommitish)
-	if err != nil {
-		return nil, err
+	treeDirPath := ""
+	if opts.GitDir != "" {
+		if opts.AllowDirty || opts.Staged {
+			return nil, errors.New("a dirty tree is not available with a git dir")
+		}
+		currentGitDir = utils.NewGitDir(opts.GitDir, opts.GitPath)
+		treeDirPath = dirPath
 	}
-	targetCommitish := opts.Target
-	if targetCommitish == "" {
-		targetCommitish, err = currentGitDir.CurrentBranch()
+	if opts.Fetch {
+		err := fetch(currentGitDir, opts.Remote)
 		if err != nil {
 			return nil, err
 		}
 	}
-	targetCommit, err := currentGitDir.CommitHash(targetCommitish)
+	base, target, err := resolveCommits(currentGitDir, opts.Remote, opts.Base, opts.Target)
+	if err != nil {
+		return nil, err
+	}
+	baseCommit, targetCommit := base.Hash, target.Hash
+	mergeBase, err := resolveMergeBase(currentGitDir, baseCommit, targetCommit)
 	if err != nil {
 		return nil, err
 	}
 
 	dirtyPatch := ""
-	if opts.AllowDirty {
+	if opts.Staged {
+		log.Infof("Generate a staged patch from %s", targetCommit)
+		diff, err := currentGitDir.DiffCached(targetCommit)
+		if err != nil {
+			return nil, err
+		}
+		dirtyPatch = diff
+	} else if opts.AllowDirty {
 		log.Infof("Generate a dirty patch from %s", targetCommit)
-		diff, err := currentGitDir.Diff(targetCommit)
+		diff, err := currentGitDir.DiffWithUntracked(targetCommit)
 		if err != nil {
 			return nil, err
 		}
 		dirtyPatch = diff
 	}
 
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = StrategyMerge
+	}
+	switch strategy {
+	case StrategyMerge, StrategyDirect:
+	case StrategyMergeBase:
+		if mergeBase == nil {
+			return nil, errors.Errorf("no merge base of %s and %s", baseCommit, targetCommit)
+		}
+		baseCommit = mergeBase.Hash
+	default:
+		return nil, errors.Errorf("unknown strategy: %q", strategy)
+	}
+
+	diffOpts := DiffOpts{
+		IncludeRegexp:           opts.IncludeRegexp,
+		ExcludeRegexp:           opts.ExcludeRegexp,
+		KustomizePath:           opts.KustomizePath,
+		KustomizeLoadRestrictor: opts.KustomizeLoadRestrictor,
+		CacheDir:                opts.CacheDir,
+		SkipUnchanged:           opts.SkipUnchanged,
+		Origins:                 opts.Origins,
+		Analyzers:               opts.Analyzers,
+		Images:                  opts.Images,
+		Capacity:                opts.Capacity,
+	}
+	repoURL := opts.RepoURL
+	if opts.Origins {
+		prefix, err := currentGitDir.Prefix()
+		if err != nil {
+			return nil, err
+		}
+		diffOpts.PathPrefix = filepath.Join(filepath.FromSlash(prefix), treeDirPath)
+		if repoURL == "" {
+			repoURL = detectRepoURL(currentGitDir, opts.Remote)
+		}
+	}
+	links, err := resolveRepoLinks(currentGitDir, repoURL, opts.RepoProvider, treeDirPath)
+	if err != nil {
+		return nil, err
+	}
+	var diffMap *DiffMap
+	var submoduleChanges []*SubmoduleChange
+	noCheckout := opts.NoCheckout
+	if noCheckout && strategy == StrategyMerge {
+		supported, err := currentGitDir.MergeTreeSupported()
+		if err != nil {
+			return nil, err
+		}
+		if !supported {
+			log.Warn("Merging without checkout needs git 2.38 or later, falling back to checkout")
+			noCheckout = false
+		}
+	}
+	if noCheckout {
+		diffMap, submoduleChanges, err = diffObjects(currentGitDir, treeDirPath, baseCommit, targetCommit, strategy, dirtyPatch, diffOpts)
+	} else {
+		diffMap, submoduleChanges, err = diffCheckouts(currentGitDir, treeDirPath, baseCommit, targetCommit, strategy, dirtyPatch, opts.Debug, diffOpts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &RunResult{
+		BaseCommit:       baseCommit,
+		TargetCommit:     targetCommit,
+		Base:             base,
+		Target:           target,
+		MergeBase:        mergeBase,
+		DiffMap:          diffMap,
+		SubmoduleChanges: submoduleChanges,
+		Links:            links,
+	}, nil
+}
+
+func detectRepoURL(gitDir *utils.GitDir, remote string) string {
+	if remote == "" {
+		remote = "origin"
+	}
+	remoteURL, err := gitDir.RemoteURL(remote)
+	if err != nil {
+		log.Debugf("Failed to get the URL of %s: %+v", remote, err)
+		return ""
+	}
+	return utils.RepoWebURL(remoteURL)
+}
+
+func diffCheckouts(currentGitDir *utils.GitDir, treeDirPath, baseCommit, targetCommit string, strategy Strategy, dirtyPatch string, debug bool, diffOpts DiffOpts) (*DiffMap, []*SubmoduleChange, error) {
 	log.Infof("Clone the git repo at %s for base", baseCommit)
 	baseDirPath, err := ioutil.TempDir("", "git-kustomize-diff-base-")
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, nil, errors.WithStack(err)
 	}
-	if opts.Debug {
+	if debug {
 		log.Infof("Base repo path: %s", baseDirPath)
 	} else {
 		defer os.RemoveAll(baseDirPath)
 	}
 	baseGitDir, err := currentGitDir.CloneAndCheckout(baseDirPath, baseCommit)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	log.Infof("Clone the git repo at %s for target", baseCommit)
+	targetCheckoutCommit := targetCommit
+	if strategy == StrategyMerge {
+		targetCheckoutCommit = baseCommit
+	}
+	log.Infof("Clone the git repo at %s for target", targetCheckoutCommit)
 	targetDirPath, err := ioutil.TempDir("", "git-kustomize-diff-target-")
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, nil, errors.WithStack(err)
 	}
-	if opts.Debug {
+	if debug {
 		log.Infof("Target repo path: %s", targetDirPath)
 	} else {
 		defer os.RemoveAll(targetDirPath)
 	}
-	targetGitDir, err := currentGitDir.CloneAndCheckout(targetDirPath, baseCommit)
+	targetGitDir, err := currentGitDir.CloneAndCheckout(targetDirPath, targetCheckoutCommit)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	log.Infof("Merge the commit at %s into the target repo", targetCommit)
-	err = targetGitDir.Merge(targetCommit)
-	if err != nil {
-		return nil, err
+	if strategy == StrategyMerge {
+		log.Infof("Merge the commit at %s into the target repo", targetCommit)
+		err = targetGitDir.Merge(targetCommit)
+		if err != nil {
+			return nil, nil, err
+		}
 	}
 	if dirtyPatch != "" {
 		log.Infof("Apply the dirty patch")
 		err = targetGitDir.Apply(dirtyPatch)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
-	diffMap, err := Diff(baseGitDir.WorkDir.Dir, targetGitDir.WorkDir.Dir, DiffOpts{
-		IncludeRegexp:           opts.IncludeRegexp,
-		ExcludeRegexp:           opts.ExcludeRegexp,
-		KustomizePath:           opts.KustomizePath,
-		KustomizeLoadRestrictor: opts.KustomizeLoadRestrictor,
-	})
+	// Compare with the tree actually built including the dirty changes.
+	targetTree := "HEAD"
+	if dirtyPatch != "" {
+		targetTree, err = targetGitDir.ApplyToTree(targetTree, dirtyPatch)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	changes, err := targetGitDir.SubmoduleChanges(baseCommit, targetTree)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetTreeDirPath := filepath.Join(targetGitDir.WorkDir.Dir, treeDirPath)
+	diffMap, err := Diff(filepath.Join(baseGitDir.WorkDir.Dir, treeDirPath), targetTreeDirPath, diffOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return diffMap, attributeSubmoduleChanges(changes, filesys.MakeFsOnDisk(), targetDirPath, targetTreeDirPath, diffMap), nil
+}
+
+// diffObjects builds the kustomizations straight from the git objects
+// without cloning the repo.
+func diffObjects(currentGitDir *utils.GitDir, treeDirPath, baseCommit, targetCommit string, strategy Strategy, dirtyPatch string, diffOpts DiffOpts) (*DiffMap, []*SubmoduleChange, error) {
+	if diffOpts.KustomizePath != "" {
+		return nil, nil, errors.New("a kustomize binary can't be used without checkout")
+	}
+	prefix, err := currentGitDir.Prefix()
+	if err != nil {
+		return nil, nil, err
+	}
+	dirPath := filepath.Join(filesys.Separator, filepath.FromSlash(prefix), treeDirPath)
+
+	targetTree := targetCommit
+	if strategy == StrategyMerge {
+		log.Infof("Merge the trees of %s and %s", baseCommit, targetCommit)
+		targetTree, err = currentGitDir.MergeTree(baseCommit, targetCommit)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if dirtyPatch != "" {
+		log.Infof("Apply the dirty patch")
+		targetTree, err = currentGitDir.ApplyToTree(targetTree, dirtyPatch)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	baseFs, err := currentGitDir.TreeFs(baseCommit)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer baseFs.Close()
+	targetFs, err := currentGitDir.TreeFs(targetTree)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer targetFs.Close()
+	changes, err := currentGitDir.SubmoduleChanges(baseCommit, targetTree)
+	if err != nil {
+		return nil, nil, err
+	}
+	diffMap, err := DiffFs(baseFs, dirPath, targetFs, dirPath, diffOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return diffMap, attributeSubmoduleChanges(changes, targetFs, filesys.Separator, dirPath, diffMap), nil
+}
+
+// attributeSubmoduleChanges finds the changed kustomizations which read
+// files in the changed submodules.
+func attributeSubmoduleChanges(changes []*utils.SubmoduleChange, fSys filesys.FileSystem, rootDirPath, dirPath string, diffMap *DiffMap) []*SubmoduleChange {
+	res := make([]*SubmoduleChange, 0, len(changes))
+	for _, change := range changes {
+		res = append(res, &SubmoduleChange{
+			Path:      change.Path,
+			OldCommit: change.OldCommit,
+			NewCommit: change.NewCommit,
+			Dirs:      make([]string, 0),
+		})
+	}
+	if len(res) == 0 {
+		return res
+	}
+	for _, kDir := range diffMap.ChangedDirs() {
+		kDirPath := filepath.Join(dirPath, kDir)
+		if !utils.KustomizationExistsInFs(fSys, kDirPath) {
+			continue
+		}
+		inputs, err := utils.ListKustomizationInputs(fSys, kDirPath)
+		if err != nil {
+			log.Debugf("Failed to list the inputs of %s: %+v", kDir, err)
+			continue
+		}
+		for _, change := range res {
+			submodulePath := filepath.Join(rootDirPath, filepath.FromSlash(change.Path)) + string(filepath.Separator)
+			for _, file := range inputs.Files {
+				if strings.HasPrefix(file, submodulePath) {
+					change.Dirs = append(change.Dirs, kDir)
+					break
+				}
+			}
+		}
+	}
+	return res
+}
+
+var baseBranchEnvs = []string{
+	// GitHub Actions
+	"GITHUB_BASE_REF",
+	// GitLab CI
+	"CI_MERGE_REQUEST_TARGET_BRANCH_NAME",
+	// Bitbucket Pipelines
+	"BITBUCKET_PR_DESTINATION_BRANCH",
+	// Jenkins
+	"CHANGE_TARGET",
+}
+
+func DetectBaseCommitish(gitDir *utils.GitDir, remote string) (string, error) {
+	if remote == "" {
+		remote = "origin"
+	}
+	for _, env := range baseBranchEnvs {
+		if branch := os.Getenv(env); branch != "" {
+			log.Debugf("Detected the base branch %s from %s", branch, env)
+			return fmt.Sprintf("%s/%s", remote, branch), nil
+		}
+	}
+	head, err := gitDir.RemoteHead(remote)
+	if err == nil && head != "" {
+		log.Debugf("Detected the base branch %s from the remote HEAD", head)
+		return head, nil
+	}
+	// Bare mirrors have the branches of the remote as local ones.
+	for _, commitish := range []string{remote + "/main", remote + "/master", "main", "master"} {
+		if _, err := gitDir.CommitHash(commitish); err == nil {
+			log.Debugf("Detected the base branch %s", commitish)
+			return commitish, nil
+		}
+	}
+	return "", errors.Errorf("failed to detect the default branch of %s", remote)
+}
+
+// fetch is the only place which accesses the remotes. Everything else is
+// resolved from the local repo.
+func fetch(gitDir *utils.GitDir, remote string) error {
+	if remote == "" {
+		log.Info("Fetch all the remotes")
+	} else {
+		log.Infof("Fetch %s", remote)
+	}
+	return gitDir.Fetch(remote)
+}
+
+func resolveCommits(gitDir *utils.GitDir, remote, baseCommitish, targetCommitish string) (*utils.CommitInfo, *utils.CommitInfo, error) {
+	var err error
+	if baseCommitish == "" {
+		baseCommitish, err = DetectBaseCommitish(gitDir, remote)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	base, err := resolveCommit(gitDir, baseCommitish)
+	if err != nil {
+		return nil, nil, err
+	}
+	if targetCommitish == "" {
+		targetCommitish, err = gitDir.CurrentBranch()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	target, err := resolveCommit(gitDir, targetCommitish)
+	if err != nil {
+		return nil, nil, err
+	}
+	return base, target, nil
+}
+
+// resolveMergeBase returns nil if the commits have no common ancestor.
+func resolveMergeBase(gitDir *utils.GitDir, baseCommit, targetCommit string) (*utils.CommitInfo, error) {
+	mergeBaseCommit, err := gitDir.MergeBase(baseCommit, targetCommit)
 	if err != nil {
 		return nil, err
 	}
+	if mergeBaseCommit == "" {
+		return nil, nil
+	}
+	return gitDir.CommitInfo(mergeBaseCommit)
+}
 
-	return &RunResult{
-		BaseCommit:   baseCommit,
-		TargetCommit: targetCommit,
-		DiffMap:      diffMap,
-	}, nil
+func resolveCommit(gitDir *utils.GitDir, commitish string) (*utils.CommitInfo, error) {
+	_, err := gitDir.CommitHash(commitish)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s is not found in the local repo, fetch it first", commitish)
+	}
+	return gitDir.CommitInfo(commitish)
 }
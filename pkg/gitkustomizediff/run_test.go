@@ -17,12 +17,15 @@ limitations under the License.
 package gitkustomizediff
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/dtaniwaki/git-kustomize-diff/pkg/utils"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -58,8 +61,607 @@ func TestRun(t *testing.T) {
 	if !assert.NoError(t, err) {
 		t.FailNow()
 	}
-	assert.Equal(t, "6206e0c", res.BaseCommit)
-	assert.Equal(t, "5a1c160", res.TargetCommit)
+	assert.Len(t, res.BaseCommit, 40)
+	assert.True(t, strings.HasPrefix(res.BaseCommit, "6206e0c"))
+	assert.Len(t, res.TargetCommit, 40)
+	assert.True(t, strings.HasPrefix(res.TargetCommit, "5a1c160"))
 	assert.Equal(t, []string{"foo"}, res.DiffMap.Dirs())
 	assert.Equal(t, expectedFooDiff, res.DiffMap.Results["foo"].ToString())
 }
+
+func TestRunStrategy(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.writePod("foo", "foo", "nginx:1.0")
+	repo.writePod("bar", "bar", "nginx:1.0")
+	initialCommit := repo.commit("initial")
+	repo.git("checkout", "-q", "-b", "feature")
+	repo.writePod("foo", "foo", "nginx:1.1")
+	featureCommit := repo.commit("bump foo")
+	repo.git("checkout", "-q", "main")
+	repo.writePod("bar", "bar", "nginx:1.2")
+	mainCommit := repo.commit("bump bar")
+
+	res, err := Run(repo.workDir.Dir, RunOpts{
+		Base:   "main",
+		Target: "feature",
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, mainCommit, res.BaseCommit)
+	assert.Equal(t, []string{"foo"}, res.DiffMap.ChangedDirs())
+	assert.Equal(t, "main", res.Base.Ref)
+	assert.Equal(t, mainCommit, res.Base.Hash)
+	assert.Equal(t, "bump bar", res.Base.Subject)
+	assert.Equal(t, "feature", res.Target.Ref)
+	assert.Equal(t, featureCommit, res.Target.Hash)
+	assert.Equal(t, "test", res.Target.Author)
+	assert.Equal(t, "test@example.com", res.Target.Email)
+	assert.False(t, res.Target.Time.IsZero())
+	assert.Equal(t, initialCommit, res.MergeBase.Hash)
+	assert.Equal(t, "initial", res.MergeBase.Subject)
+
+	res, err = Run(repo.workDir.Dir, RunOpts{
+		Base:     "main",
+		Target:   "feature",
+		Strategy: StrategyDirect,
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, mainCommit, res.BaseCommit)
+	assert.Equal(t, []string{"bar", "foo"}, res.DiffMap.ChangedDirs())
+
+	res, err = Run(repo.workDir.Dir, RunOpts{
+		Base:     "main",
+		Target:   "feature",
+		Strategy: StrategyMergeBase,
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, initialCommit, res.BaseCommit)
+	assert.Equal(t, featureCommit, res.TargetCommit)
+	assert.Equal(t, []string{"foo"}, res.DiffMap.ChangedDirs())
+
+	_, err = Run(repo.workDir.Dir, RunOpts{
+		Base:     "main",
+		Target:   "feature",
+		Strategy: "unknown",
+	})
+	assert.Error(t, err)
+
+	repo.writePod("foo", "foo", "nginx:2.0")
+	repo.commit("conflict foo")
+	_, err = Run(repo.workDir.Dir, RunOpts{
+		Base:   "main",
+		Target: "feature",
+	})
+	var conflictErr *utils.MergeConflictError
+	if !assert.True(t, errors.As(err, &conflictErr)) {
+		t.FailNow()
+	}
+	assert.Equal(t, featureCommit, conflictErr.Commit)
+	assert.Equal(t, []string{"foo/pod.yaml"}, conflictErr.Files)
+
+	_, err = Run(repo.workDir.Dir, RunOpts{
+		Base:     "main",
+		Target:   "feature",
+		Strategy: StrategyDirect,
+	})
+	assert.NoError(t, err)
+
+	repo.git("checkout", "-q", "--orphan", "unrelated")
+	repo.commit("unrelated")
+	_, err = Run(repo.workDir.Dir, RunOpts{
+		Base:     "main",
+		Target:   "unrelated",
+		Strategy: StrategyMergeBase,
+	})
+	assert.EqualError(t, err, fmt.Sprintf("no merge base of %s and %s", repo.git("rev-parse", "main"), repo.git("rev-parse", "unrelated")))
+}
+
+func TestDetectBaseCommitish(t *testing.T) {
+	for _, env := range baseBranchEnvs {
+		if val, ok := os.LookupEnv(env); ok {
+			os.Unsetenv(env)
+			defer os.Setenv(env, val)
+		}
+	}
+
+	repo := newTestRepo(t)
+	repo.git("checkout", "-q", "-b", "develop")
+	repo.writePod("foo", "foo", "nginx:1.0")
+	repo.commit("initial")
+	repo.git("branch", "-q", "release")
+
+	clone := newTestRepo(t)
+	clone.git("remote", "add", "upstream", repo.workDir.Dir)
+	clone.git("fetch", "-q", "upstream")
+	gitDir := utils.NewGitDir(clone.workDir.Dir, "")
+
+	_, err := DetectBaseCommitish(gitDir, "upstream")
+	assert.Error(t, err)
+
+	clone.git("remote", "set-head", "upstream", "develop")
+	commitish, err := DetectBaseCommitish(gitDir, "upstream")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "upstream/develop", commitish)
+
+	os.Setenv("CHANGE_TARGET", "release")
+	defer os.Unsetenv("CHANGE_TARGET")
+	commitish, err = DetectBaseCommitish(gitDir, "upstream")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "upstream/release", commitish)
+	os.Unsetenv("CHANGE_TARGET")
+
+	repo.git("branch", "-q", "master")
+	clone.git("fetch", "-q", "upstream")
+	clone.git("remote", "set-head", "upstream", "-d")
+	commitish, err = DetectBaseCommitish(gitDir, "upstream")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "upstream/master", commitish)
+}
+
+func TestRunDirty(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.writePod("foo", "foo", "nginx:1.0")
+	repo.writePod("bar", "bar", "nginx:1.0")
+	repo.commit("initial")
+	repo.write(".gitignore", "ignored/\n")
+	repo.commit("add gitignore")
+
+	repo.writePod("foo", "foo", "nginx:1.1")
+	repo.git("add", "foo")
+	repo.writePod("bar", "bar", "nginx:1.1")
+	repo.writePod("baz", "baz", "nginx:1.0")
+	repo.writePod("ignored", "ignored", "nginx:1.0")
+
+	res, err := Run(repo.workDir.Dir, RunOpts{
+		Base:   "main",
+		Target: "main",
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{}, res.DiffMap.ChangedDirs())
+
+	res, err = Run(repo.workDir.Dir, RunOpts{
+		Base:       "main",
+		Target:     "main",
+		AllowDirty: true,
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"bar", "baz", "foo"}, res.DiffMap.ChangedDirs())
+
+	res, err = Run(repo.workDir.Dir, RunOpts{
+		Base:   "main",
+		Target: "main",
+		Staged: true,
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"foo"}, res.DiffMap.ChangedDirs())
+
+	status := repo.git("status", "--porcelain")
+	assert.Contains(t, status, "M  foo/pod.yaml")
+	assert.Contains(t, status, "?? baz/")
+}
+
+type testRepo struct {
+	t       *testing.T
+	workDir *utils.WorkDir
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	tmpGitDir, err := ioutil.TempDir("", "kustomize-diff-test-")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(tmpGitDir)
+	})
+	r := &testRepo{t: t, workDir: &utils.WorkDir{Dir: tmpGitDir}}
+	r.git("init", "-q", "-b", "main")
+	r.git("config", "user.email", "test@example.com")
+	r.git("config", "user.name", "test")
+	return r
+}
+
+func (r *testRepo) git(args ...string) string {
+	stdout, _, err := r.workDir.RunCommand("git", args...)
+	if !assert.NoError(r.t, err) {
+		r.t.FailNow()
+	}
+	return strings.Trim(stdout, "\n")
+}
+
+func (r *testRepo) write(path, content string) {
+	fullPath := filepath.Join(r.workDir.Dir, path)
+	if !assert.NoError(r.t, os.MkdirAll(filepath.Dir(fullPath), 0700)) {
+		r.t.FailNow()
+	}
+	if !assert.NoError(r.t, ioutil.WriteFile(fullPath, []byte(content), 0600)) {
+		r.t.FailNow()
+	}
+}
+
+func (r *testRepo) writePod(dir, name, image string) {
+	r.write(filepath.Join(dir, "kustomization.yaml"), "resources:\n- pod.yaml\n")
+	r.write(filepath.Join(dir, "pod.yaml"), fmt.Sprintf(`apiVersion: v1
+kind: Pod
+metadata:
+  name: %s
+spec:
+  containers:
+  - name: %s
+    image: %s
+`, name, name, image))
+}
+
+func (r *testRepo) commit(message string) string {
+	r.git("add", "-A")
+	r.git("commit", "-q", "--allow-empty", "-m", message)
+	return r.git("rev-parse", "HEAD")
+}
+
+func TestRunNoCheckout(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.writePod("k8s/foo", "foo", "nginx:1.0")
+	repo.writePod("k8s/bar", "bar", "nginx:1.0")
+	repo.commit("initial")
+	repo.git("checkout", "-q", "-b", "feature")
+	repo.writePod("k8s/foo", "foo", "nginx:1.1")
+	repo.writePod("k8s/baz", "baz", "nginx:1.0")
+	repo.commit("bump foo and add baz")
+	repo.git("checkout", "-q", "main")
+	repo.writePod("k8s/bar", "bar", "nginx:1.2")
+	repo.commit("bump bar")
+	repo.git("checkout", "-q", "feature")
+	repo.writePod("k8s/foo", "foo", "nginx:1.3")
+
+	dirPath := filepath.Join(repo.workDir.Dir, "k8s")
+	for _, opts := range []RunOpts{
+		{Base: "main", Target: "feature"},
+		{Base: "main", Target: "feature", Strategy: StrategyMergeBase},
+		{Base: "main", Target: "feature", Strategy: StrategyDirect},
+		{Base: "main", Target: "feature", AllowDirty: true},
+	} {
+		expected, err := Run(dirPath, opts)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		opts.NoCheckout = true
+		actual, err := Run(dirPath, opts)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		assert.Equal(t, expected.BaseCommit, actual.BaseCommit)
+		assert.Equal(t, expected.TargetCommit, actual.TargetCommit)
+		assert.Equal(t, expected.DiffMap.ChangedDirs(), actual.DiffMap.ChangedDirs())
+		for _, dir := range expected.DiffMap.ChangedDirs() {
+			assert.Equal(t, expected.DiffMap.Results[dir].ToString(), actual.DiffMap.Results[dir].ToString())
+		}
+	}
+
+	repo.git("checkout", "-q", ".")
+	repo.git("checkout", "-q", "main")
+	repo.writePod("k8s/foo", "foo", "nginx:2.0")
+	repo.commit("conflict foo")
+	_, err := Run(dirPath, RunOpts{
+		Base:       "main",
+		Target:     "feature",
+		NoCheckout: true,
+	})
+	var conflictErr *utils.MergeConflictError
+	if !assert.True(t, errors.As(err, &conflictErr)) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"k8s/foo/pod.yaml"}, conflictErr.Files)
+}
+
+func TestRunGitDir(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.writePod("k8s/foo", "foo", "nginx:1.0")
+	repo.writePod("k8s/bar", "bar", "nginx:1.0")
+	repo.commit("initial")
+	repo.git("checkout", "-q", "-b", "feature")
+	repo.writePod("k8s/foo", "foo", "nginx:1.1")
+	repo.commit("bump foo")
+	repo.git("checkout", "-q", "main")
+
+	mirror := newTestRepo(t)
+	mirror.git("clone", "-q", "--mirror", repo.workDir.Dir, mirror.workDir.Dir+"/repo.git")
+	for _, gitDir := range []string{
+		filepath.Join(mirror.workDir.Dir, "repo.git"),
+		filepath.Join(repo.workDir.Dir, ".git"),
+	} {
+		for _, noCheckout := range []bool{false, true} {
+			res, err := Run("k8s", RunOpts{
+				Target:     "feature",
+				GitDir:     gitDir,
+				NoCheckout: noCheckout,
+			})
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			assert.Equal(t, []string{"foo"}, res.DiffMap.ChangedDirs())
+		}
+	}
+
+	_, err := Run("k8s", RunOpts{
+		Target:     "feature",
+		GitDir:     filepath.Join(mirror.workDir.Dir, "repo.git"),
+		AllowDirty: true,
+	})
+	assert.Error(t, err)
+}
+
+func TestRunSubmodule(t *testing.T) {
+	platform := newTestRepo(t)
+	platform.writePod("base", "app", "nginx:1.0")
+	platform.commit("initial")
+
+	repo := newTestRepo(t)
+	repo.git("-c", "protocol.file.allow=always", "submodule", "add", "-q", platform.workDir.Dir, "vendor/platform")
+	repo.write("k8s/app/kustomization.yaml", "resources:\n- ../../vendor/platform/base\n")
+	repo.write("k8s/other/kustomization.yaml", "resources:\n- pod.yaml\n")
+	repo.writePod("k8s/other", "other", "nginx:1.0")
+	repo.commit("initial")
+
+	platform.writePod("base", "app", "nginx:1.1")
+	platformCommit := platform.commit("bump app")
+	repo.git("checkout", "-q", "-b", "feature")
+	repo.git("-C", "vendor/platform", "pull", "-q", "origin", "main")
+	repo.commit("bump platform")
+	// The submodule must be cloned from the local modules dir.
+	os.RemoveAll(platform.workDir.Dir)
+
+	dirPath := filepath.Join(repo.workDir.Dir, "k8s")
+	for _, noCheckout := range []bool{false, true} {
+		res, err := Run(dirPath, RunOpts{
+			Base:       "main",
+			Target:     "feature",
+			NoCheckout: noCheckout,
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		assert.Equal(t, []string{"app"}, res.DiffMap.ChangedDirs())
+		assert.Contains(t, res.DiffMap.Results["app"].ToString(), "+  - image: nginx:1.1")
+		if !assert.Len(t, res.SubmoduleChanges, 1) {
+			t.FailNow()
+		}
+		assert.Equal(t, "vendor/platform", res.SubmoduleChanges[0].Path)
+		assert.True(t, strings.HasPrefix(res.SubmoduleChanges[0].NewCommit, platformCommit))
+		assert.Equal(t, []string{"app"}, res.SubmoduleChanges[0].Dirs)
+	}
+
+	// A staged bump is reported as well.
+	repo.git("checkout", "-q", "main")
+	repo.git("add", "vendor/platform")
+	for _, noCheckout := range []bool{false, true} {
+		res, err := Run(dirPath, RunOpts{
+			Base:       "main",
+			Target:     "main",
+			Staged:     true,
+			NoCheckout: noCheckout,
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		if !assert.Len(t, res.SubmoduleChanges, 1) {
+			t.FailNow()
+		}
+		assert.Equal(t, "vendor/platform", res.SubmoduleChanges[0].Path)
+		assert.True(t, strings.HasPrefix(res.SubmoduleChanges[0].NewCommit, platformCommit))
+	}
+}
+
+func TestRunFetch(t *testing.T) {
+	upstream := newTestRepo(t)
+	upstream.writePod("foo", "foo", "nginx:1.0")
+	upstream.commit("initial")
+
+	repo := newTestRepo(t)
+	repo.git("remote", "add", "origin", upstream.workDir.Dir)
+	repo.git("fetch", "-q", "origin")
+	repo.git("checkout", "-q", "main")
+
+	upstream.git("checkout", "-q", "-b", "feature")
+	upstream.writePod("foo", "foo", "nginx:1.1")
+	upstream.commit("bump foo")
+
+	_, err := Run(repo.workDir.Dir, RunOpts{
+		Base:   "origin/main",
+		Target: "origin/feature",
+	})
+	if !assert.Error(t, err) {
+		t.FailNow()
+	}
+	assert.Contains(t, err.Error(), "origin/feature is not found in the local repo")
+
+	res, err := Run(repo.workDir.Dir, RunOpts{
+		Base:   "origin/main",
+		Target: "origin/feature",
+		Remote: "origin",
+		Fetch:  true,
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"foo"}, res.DiffMap.ChangedDirs())
+
+	// The remote is not accessed without fetch.
+	repo.git("remote", "set-url", "origin", filepath.Join(upstream.workDir.Dir, "missing"))
+	res, err = Run(repo.workDir.Dir, RunOpts{
+		Base:   "origin/main",
+		Target: "origin/feature",
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"foo"}, res.DiffMap.ChangedDirs())
+}
+
+func TestRunOrigins(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.git("remote", "add", "origin", "git@github.com:example/repo.git")
+	repo.writePod("k8s/base", "app", "nginx:1.0")
+	repo.write("k8s/overlay/kustomization.yaml", "resources:\n- ../base\npatchesStrategicMerge:\n- patch.yaml\n")
+	repo.write("k8s/overlay/patch.yaml", "apiVersion: v1\nkind: Pod\nmetadata:\n  name: app\n  labels:\n    env: prod\n")
+	repo.commit("initial")
+	repo.git("checkout", "-q", "-b", "feature")
+	repo.writePod("k8s/base", "app", "nginx:1.1")
+	repo.commit("bump app")
+
+	for _, noCheckout := range []bool{false, true} {
+		res, err := Run(filepath.Join(repo.workDir.Dir, "k8s"), RunOpts{
+			Base:       "main",
+			Target:     "feature",
+			NoCheckout: noCheckout,
+			Origins:    true,
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		if !assert.NotNil(t, res.Links) {
+			t.FailNow()
+		}
+		assert.Equal(t, "https://github.com/example/repo", res.Links.URL)
+		assert.Equal(t, "k8s/overlay", res.Links.Path("overlay"))
+		assert.Equal(t, []string{"base", "overlay"}, res.DiffMap.ChangedDirs())
+		assert.NotContains(t, res.DiffMap.Results["overlay"].ToString(), originAnnotation)
+		assert.Equal(t, []*ResourceSource{
+			{
+				ID:    ResourceID{Kind: "Pod", Name: "app"},
+				Type:  ResourceChanged,
+				Files: []string{"k8s/base/pod.yaml", "k8s/overlay/patch.yaml"},
+			},
+		}, res.DiffMap.Results["overlay"].(*DiffContent).Sources)
+		assert.Equal(t, res.TargetCommit, res.SourceCommit(ResourceChanged))
+	}
+
+	// A removed resource is resolved to the files at the base commit.
+	repo.git("checkout", "-q", "-b", "removal", "main")
+	repo.git("rm", "-q", "k8s/overlay/patch.yaml")
+	repo.write("k8s/overlay/kustomization.yaml", "resources: []\n")
+	repo.commit("remove app")
+	for _, noCheckout := range []bool{false, true} {
+		res, err := Run(filepath.Join(repo.workDir.Dir, "k8s"), RunOpts{
+			Base:       "main",
+			Target:     "removal",
+			NoCheckout: noCheckout,
+			Origins:    true,
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		assert.Equal(t, []string{"overlay"}, res.DiffMap.ChangedDirs())
+		assert.Equal(t, []*ResourceSource{
+			{
+				ID:    ResourceID{Kind: "Pod", Name: "app"},
+				Type:  ResourceRemoved,
+				Files: []string{"k8s/base/pod.yaml", "k8s/overlay/patch.yaml"},
+			},
+		}, res.DiffMap.Results["overlay"].(*DiffContent).Sources)
+		assert.Equal(t, res.BaseCommit, res.SourceCommit(ResourceRemoved))
+	}
+}
+
+func TestRunAnalyzers(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.write("k8s/app/kustomization.yaml", "resources:\n- namespace.yaml\n- pod.yaml\n")
+	repo.write("k8s/app/namespace.yaml", "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: app\n")
+	repo.write("k8s/app/pod.yaml", "apiVersion: v1\nkind: Pod\nmetadata:\n  name: app\n")
+	repo.commit("initial")
+	repo.git("checkout", "-q", "-b", "feature")
+	repo.write("k8s/app/kustomization.yaml", "resources:\n- pod.yaml\n")
+	repo.commit("delete the namespace")
+
+	riskAnalyzer, err := NewAnalyzer("risk", AnalyzerOpts{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	res, err := Run(filepath.Join(repo.workDir.Dir, "k8s"), RunOpts{
+		Base:      "main",
+		Target:    "feature",
+		Analyzers: []Analyzer{riskAnalyzer},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []*Finding{
+		{
+			Analyzer: "risk",
+			Severity: SeverityHigh,
+			Dir:      "app",
+			ID:       ResourceID{Kind: "Namespace", Name: "app"},
+			Message:  "Namespace is deleted",
+		},
+	}, res.DiffMap.AnalyzerFindings("risk"))
+	assert.True(t, res.DiffMap.HasFindings(SeverityHigh))
+
+	_, err = NewAnalyzer("unknown", AnalyzerOpts{})
+	assert.Error(t, err)
+}
+
+type failingAnalyzer struct{}
+
+func (a *failingAnalyzer) Name() string {
+	return "failing"
+}
+
+func (a *failingAnalyzer) Title() string {
+	return "Failing"
+}
+
+func (a *failingAnalyzer) Analyze(base, target []*Resource) ([]*Finding, error) {
+	return nil, errors.New("broken")
+}
+
+func TestRunAnalyzerError(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.write("k8s/app/kustomization.yaml", "resources:\n- namespace.yaml\n- pod.yaml\n")
+	repo.write("k8s/app/namespace.yaml", "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: app\n")
+	repo.write("k8s/app/pod.yaml", "apiVersion: v1\nkind: Pod\nmetadata:\n  name: app\n")
+	repo.commit("initial")
+	repo.git("checkout", "-q", "-b", "feature")
+	repo.write("k8s/app/kustomization.yaml", "resources:\n- pod.yaml\n")
+	repo.commit("delete the namespace")
+
+	riskAnalyzer, err := NewAnalyzer("risk", AnalyzerOpts{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	res, err := Run(filepath.Join(repo.workDir.Dir, "k8s"), RunOpts{
+		Base:      "main",
+		Target:    "feature",
+		Analyzers: []Analyzer{&failingAnalyzer{}, riskAnalyzer},
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// The diff and the findings of the other analyzers are kept.
+	if !assert.IsType(t, &DiffContent{}, res.DiffMap.Results["app"]) {
+		t.FailNow()
+	}
+	assert.Contains(t, res.DiffMap.Results["app"].ToString(), "kind: Namespace")
+	assert.Len(t, res.DiffMap.AnalyzerFindings("risk"), 1)
+	analyzerErrors := res.DiffMap.AllAnalyzerErrors()
+	if !assert.Len(t, analyzerErrors, 1) {
+		t.FailNow()
+	}
+	assert.Equal(t, "failing", analyzerErrors[0].Analyzer)
+	assert.Equal(t, "app", analyzerErrors[0].Dir)
+	assert.EqualError(t, analyzerErrors[0], "failing failed on app: broken")
+}
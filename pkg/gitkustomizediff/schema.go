@@ -0,0 +1,408 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"sigs.k8s.io/kustomize/kyaml/kio"
+	"sigs.k8s.io/kustomize/kyaml/openapi/kubernetesapi"
+)
+
+// bundledSchemaVersions maps the Kubernetes versions to the OpenAPI schemas
+// bundled in kyaml.
+var bundledSchemaVersions = map[string]string{
+	"1.21": "v1212",
+}
+
+const (
+	intOrStringDefinition = "io.k8s.apimachinery.pkg.util.intstr.IntOrString"
+	quantityDefinition    = "io.k8s.apimachinery.pkg.api.resource.Quantity"
+)
+
+type groupVersionKind struct {
+	Group   string
+	Version string
+	Kind    string
+}
+
+// SchemaAnalyzer validates the target builds against the OpenAPI schemas of
+// Kubernetes and the CRDs. The resources without schemas are skipped.
+type SchemaAnalyzer struct {
+	definitions spec.Definitions
+	schemas     map[groupVersionKind]*spec.Schema
+}
+
+// NewSchemaAnalyzer loads the schemas. The swagger files such as
+// api/openapi-spec/swagger.json of Kubernetes replace the bundled schema of
+// the version, which defaults to the latest bundled one. The CRDs in the
+// dirs and in the builds are used as well.
+func NewSchemaAnalyzer(kubeVersion string, schemaFiles, crdDirs []string) (*SchemaAnalyzer, error) {
+	a := &SchemaAnalyzer{
+		definitions: spec.Definitions{},
+		schemas:     map[groupVersionKind]*spec.Schema{},
+	}
+	if len(schemaFiles) == 0 {
+		version := kubernetesapi.DefaultOpenAPI
+		if kubeVersion != "" {
+			minor, err := parseKubeMinorVersion(kubeVersion)
+			if err != nil {
+				return nil, err
+			}
+			v, ok := bundledSchemaVersions[fmt.Sprintf("1.%d", minor)]
+			if !ok {
+				return nil, errors.Errorf("no bundled schema for Kubernetes %s (available: %s), give the swagger file of the version", kubeVersion, strings.Join(SchemaVersions(), ", "))
+			}
+			version = v
+		}
+		err := a.addSwagger(kubernetesapi.OpenAPIMustAsset[version](filepath.Join("kubernetesapi", version, "swagger.json")))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range schemaFiles {
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		err = a.addSwagger(bs)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the schema %s", path)
+		}
+	}
+	for _, dir := range crdDirs {
+		resources, err := readResourceDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for gvk, schema := range crdSchemas(resources) {
+			a.schemas[gvk] = schema
+		}
+	}
+	return a, nil
+}
+
+// SchemaVersions returns the Kubernetes versions of the bundled schemas.
+func SchemaVersions() []string {
+	versions := make([]string, 0, len(bundledSchemaVersions))
+	for version := range bundledSchemaVersions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// parseKubeMinorVersion parses a Kubernetes version such as v1.25.3 into the
+// minor version.
+func parseKubeMinorVersion(s string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "v"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, errors.Errorf("invalid Kubernetes version: %q", s)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, errors.Errorf("invalid Kubernetes version: %q", s)
+	}
+	return minor, nil
+}
+
+func (a *SchemaAnalyzer) Name() string {
+	return "schema"
+}
+
+func (a *SchemaAnalyzer) Title() string {
+	return "Schema Errors"
+}
+
+func (a *SchemaAnalyzer) Analyze(base, target []*Resource) ([]*Finding, error) {
+	schemas := a.schemas
+	if crdSchemas := crdSchemas(target); len(crdSchemas) > 0 {
+		schemas = make(map[groupVersionKind]*spec.Schema, len(a.schemas)+len(crdSchemas))
+		for gvk, schema := range a.schemas {
+			schemas[gvk] = schema
+		}
+		for gvk, schema := range crdSchemas {
+			schemas[gvk] = schema
+		}
+	}
+	findings := make([]*Finding, 0)
+	for _, res := range target {
+		version := res.APIVersion
+		if i := strings.LastIndex(version, "/"); i >= 0 {
+			version = version[i+1:]
+		}
+		schema, ok := schemas[groupVersionKind{res.ID.Group, version, res.ID.Kind}]
+		if !ok {
+			continue
+		}
+		for _, message := range a.validateRoot(res.Object, schema) {
+			findings = append(findings, &Finding{Severity: SeverityHigh, ID: res.ID, Message: message})
+		}
+	}
+	return findings, nil
+}
+
+func (a *SchemaAnalyzer) addSwagger(bs []byte) error {
+	swagger := spec.Swagger{}
+	err := swagger.UnmarshalJSON(bs)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for name := range swagger.Definitions {
+		schema := swagger.Definitions[name]
+		a.definitions[name] = schema
+		gvks, _ := schema.Extensions["x-kubernetes-group-version-kind"].([]interface{})
+		for _, gvk := range gvks {
+			group, _ := lookupField(gvk, "group")
+			version, _ := lookupField(gvk, "version")
+			kind, _ := lookupField(gvk, "kind")
+			a.schemas[groupVersionKind{fmt.Sprint(group), fmt.Sprint(version), fmt.Sprint(kind)}] = &schema
+		}
+	}
+	return nil
+}
+
+// readResourceDir reads the resources in the YAML and JSON files in the dir.
+func readResourceDir(dir string) ([]*Resource, error) {
+	resources := make([]*Resource, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		bs, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		nodes, err := kio.FromBytes(bs)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", path)
+		}
+		for _, node := range nodes {
+			res, err := NewResource(node)
+			if err != nil {
+				return errors.Wrapf(err, "failed to parse %s", path)
+			}
+			resources = append(resources, res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// crdSchemas extracts the schemas of the versions of the CRDs.
+func crdSchemas(resources []*Resource) map[groupVersionKind]*spec.Schema {
+	schemas := map[groupVersionKind]*spec.Schema{}
+	for _, res := range resources {
+		if res.ID.Kind != "CustomResourceDefinition" {
+			continue
+		}
+		group := optionalFieldString(res, "spec.group")
+		kind := optionalFieldString(res, "spec.names.kind")
+		for _, version := range fieldList(res, "spec.versions") {
+			name, _ := lookupField(version, "name")
+			value, ok := lookupField(version, "schema.openAPIV3Schema")
+			if !ok {
+				// The schema of v1beta1 CRDs is shared by the versions.
+				value, ok = res.Field("spec.validation.openAPIV3Schema")
+			}
+			if !ok {
+				continue
+			}
+			bs, err := json.Marshal(value)
+			if err != nil {
+				continue
+			}
+			schema := &spec.Schema{}
+			if err := schema.UnmarshalJSON(bs); err != nil {
+				continue
+			}
+			schemas[groupVersionKind{group, fmt.Sprint(name), kind}] = schema
+		}
+	}
+	return schemas
+}
+
+// validateRoot validates a resource, whose apiVersion, kind and metadata are
+// allowed without being declared in the schemas of CRDs.
+func (a *SchemaAnalyzer) validateRoot(obj map[string]interface{}, schema *spec.Schema) []string {
+	messages := make([]string, 0)
+	for _, name := range schema.Required {
+		if _, ok := obj[name]; !ok {
+			messages = append(messages, fmt.Sprintf("missing required field `%s`", name))
+		}
+	}
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		prop, ok := schema.Properties[key]
+		if !ok {
+			switch key {
+			case "apiVersion", "kind", "metadata":
+				continue
+			}
+		}
+		messages = append(messages, a.validateField(key, obj[key], schema, prop, ok)...)
+	}
+	return messages
+}
+
+func (a *SchemaAnalyzer) validate(path string, value interface{}, schema *spec.Schema) []string {
+	if value == nil || schema == nil {
+		return nil
+	}
+	if ref := schema.Ref.String(); ref != "" {
+		name := strings.TrimPrefix(ref, "#/definitions/")
+		switch name {
+		case intOrStringDefinition, quantityDefinition:
+			switch value.(type) {
+			case string, json.Number:
+				return nil
+			}
+			return []string{fmt.Sprintf("`%s` must be a string or a number", path)}
+		}
+		definition, ok := a.definitions[name]
+		if !ok {
+			return nil
+		}
+		schema = &definition
+	}
+	if preserve, _ := schema.Extensions["x-kubernetes-int-or-string"].(bool); preserve {
+		switch value.(type) {
+		case string, json.Number:
+			return nil
+		}
+		return []string{fmt.Sprintf("`%s` must be a string or a number", path)}
+	}
+	if len(schema.Type) > 0 && !schemaTypeMatches(schema, value) {
+		return []string{fmt.Sprintf("`%s` must be %s, not %s", path, strings.Join(schema.Type, " or "), jsonTypeName(value))}
+	}
+	messages := make([]string, 0)
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				messages = append(messages, fmt.Sprintf("missing required field `%s.%s`", path, name))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			prop, ok := schema.Properties[key]
+			messages = append(messages, a.validateField(path+"."+key, v[key], schema, prop, ok)...)
+		}
+	case []interface{}:
+		if schema.Items != nil && schema.Items.Schema != nil {
+			for i, elem := range v {
+				messages = append(messages, a.validate(fmt.Sprintf("%s[%d]", path, i), elem, schema.Items.Schema)...)
+			}
+		}
+	}
+	return messages
+}
+
+// validateField validates a field of an object, which is either declared in
+// the properties or allowed by the additional properties.
+func (a *SchemaAnalyzer) validateField(path string, value interface{}, parent *spec.Schema, prop spec.Schema, declared bool) []string {
+	if declared {
+		return a.validate(path, value, &prop)
+	}
+	if parent.AdditionalProperties != nil {
+		if parent.AdditionalProperties.Schema != nil {
+			return a.validate(path, value, parent.AdditionalProperties.Schema)
+		}
+		if parent.AdditionalProperties.Allows {
+			return nil
+		}
+	}
+	if preserve, _ := parent.Extensions["x-kubernetes-preserve-unknown-fields"].(bool); preserve || len(parent.Properties) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("unknown field `%s`", path)}
+}
+
+func schemaTypeMatches(schema *spec.Schema, value interface{}) bool {
+	for _, t := range schema.Type {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if _, err := v.Int64(); err == nil && t == "integer" {
+				return true
+			}
+			if t == "string" && schema.Format == "int-or-string" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
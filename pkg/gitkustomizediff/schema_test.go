@@ -0,0 +1,138 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gitkustomizediff
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaAnalyzer(t *testing.T) {
+	target, err := ParseResources(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: app
+spec:
+  replica: 2
+  selector:
+    matchLabels:
+      app: app
+  template:
+    spec:
+      containers:
+      - image: nginx
+        ports:
+        - containerPort: "80"
+        resources:
+          requests:
+            cpu: 1
+            memory: 1Gi
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+spec:
+  labels:
+    foo: bar
+---
+apiVersion: example.com/v1
+kind: Gadget
+metadata:
+  name: gadget
+spec:
+  anything: true
+`)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	analyzer, err := NewSchemaAnalyzer("", nil, []string{filepath.Join("fixtures", "schema")})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	findings := analyzeTestBuilds(t, analyzer, nil, target)
+	deployment := target[0].ID
+	widget := target[1].ID
+	assert.Equal(t, []*Finding{
+		{Severity: SeverityHigh, ID: deployment, Message: "unknown field `spec.replica`"},
+		{Severity: SeverityHigh, ID: deployment, Message: "missing required field `spec.template.spec.containers[0].name`"},
+		{Severity: SeverityHigh, ID: deployment, Message: "`spec.template.spec.containers[0].ports[0].containerPort` must be integer, not string"},
+		{Severity: SeverityHigh, ID: widget, Message: "missing required field `spec.size`"},
+	}, findings)
+}
+
+func TestSchemaAnalyzerCRDInBuild(t *testing.T) {
+	target, err := readResourceDir(filepath.Join("fixtures", "schema"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	widget, err := ParseResources("apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: widget\nspec:\n  size: large\n")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	analyzer, err := NewSchemaAnalyzer("v1.21.2", nil, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	findings := analyzeTestBuilds(t, analyzer, nil, append(target, widget...))
+	assert.Equal(t, []*Finding{{Severity: SeverityHigh, ID: widget[0].ID, Message: "`spec.size` must be integer, not string"}}, findings)
+
+	// The versions without bundled schemas are rejected instead of validated with another version.
+	for _, version := range []string{"1.0", "1.25"} {
+		_, err = NewSchemaAnalyzer(version, nil, nil)
+		if assert.Error(t, err, version) {
+			assert.Contains(t, err.Error(), "no bundled schema for Kubernetes "+version)
+		}
+	}
+}
+
+func TestSchemaAnalyzerSchemaFile(t *testing.T) {
+	analyzer, err := NewSchemaAnalyzer("1.30", []string{filepath.Join("fixtures", "schema-files", "swagger.json")}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	target, err := ParseResources(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+data:
+  replicas: 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replica: 1
+`)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	findings, err := analyzer.Analyze(nil, target)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// The bundled schema is replaced by the file.
+	assert.Equal(t, []*Finding{{Severity: SeverityHigh, ID: target[0].ID, Message: "`data.replicas` must be string, not number"}}, findings)
+
+	_, err = NewSchemaAnalyzer("", []string{filepath.Join("fixtures", "schema", "crd.yaml")}, nil)
+	assert.Error(t, err)
+}
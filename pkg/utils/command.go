@@ -66,12 +66,7 @@ func (wd *WorkDir) RunCommand(command string, args ...string) (string, string, e
 	stdout := bytes.NewBufferString("")
 	stderr := bytes.NewBufferString("")
 	cmd.Dir = wd.Dir
-	env := make([]string, 0, len(os.Environ())+len(wd.Env)+1)
-	env = append(env, os.Environ()...)
-	for key, val := range wd.Env {
-		env = append(env, fmt.Sprintf("%s=%s", key, val))
-	}
-	cmd.Env = env
+	cmd.Env = wd.environ()
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 	err := cmd.Run()
@@ -84,3 +79,12 @@ func (wd *WorkDir) RunCommand(command string, args ...string) (string, string, e
 	}
 	return stdout.String(), stderr.String(), err
 }
+
+func (wd *WorkDir) environ() []string {
+	env := make([]string, 0, len(os.Environ())+len(wd.Env))
+	env = append(env, os.Environ()...)
+	for key, val := range wd.Env {
+		env = append(env, fmt.Sprintf("%s=%s", key, val))
+	}
+	return env
+}
@@ -17,18 +17,53 @@ limitations under the License.
 package utils
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/yookoala/realpath"
 )
 
+type MergeConflictError struct {
+	Commit string
+	Files  []string
+}
+
+func (mce *MergeConflictError) Error() string {
+	return fmt.Sprintf("merge conflicts with %s in %d files:\n%s", mce.Commit, len(mce.Files), strings.Join(mce.Files, "\n"))
+}
+
+type SubmoduleChange struct {
+	Path      string
+	OldCommit string
+	NewCommit string
+}
+
+type CommitInfo struct {
+	// Ref is the commitish the commit was resolved from.
+	Ref     string
+	Hash    string
+	Subject string
+	Author  string
+	Email   string
+	Time    time.Time
+}
+
 type GitDir struct {
 	GitPath string
 	WorkDir WorkDir
+	// ModulesDir is the modules dir of the repo this repo was cloned from,
+	// which the submodules are cloned from on checkout.
+	ModulesDir string
 }
 
 func NewGitDir(dirPath, gitPath string) *GitDir {
@@ -48,22 +83,127 @@ func (gd *GitDir) RunGitCommand(args ...string) (string, string, error) {
 	return gd.WorkDir.RunCommand(gitPath, args...)
 }
 
+// CommitHash returns the full hash of the commit.
 func (gd *GitDir) CommitHash(target string) (string, error) {
-	stdout, _, err := gd.RunGitCommand("rev-parse", "-q", "--short", target)
+	stdout, _, err := gd.RunGitCommand("rev-parse", "-q", "--verify", target+"^{commit}")
 	if err != nil {
 		return "", err
 	}
 	return strings.Trim(stdout, "\n"), nil
 }
 
+func (gd *GitDir) CommitInfo(target string) (*CommitInfo, error) {
+	stdout, _, err := gd.RunGitCommand("log", "-1", "--format=%H%x00%s%x00%an%x00%ae%x00%cI", target+"^{commit}", "--")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(stdout, "\n"), "\x00")
+	if len(fields) != 5 {
+		return nil, errors.Errorf("unexpected log output: %q", stdout)
+	}
+	commitTime, err := time.Parse(time.RFC3339, fields[4])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &CommitInfo{
+		Ref:     target,
+		Hash:    fields[0],
+		Subject: fields[1],
+		Author:  fields[2],
+		Email:   fields[3],
+		Time:    commitTime,
+	}, nil
+}
+
+func (gd *GitDir) RevList(args ...string) ([]string, error) {
+	stdout, _, err := gd.RunGitCommand(append([]string{"rev-list"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]string, 0)
+	for _, line := range strings.Split(stdout, "\n") {
+		if line != "" {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+// Parents returns the parent commits, which are empty for a root commit.
+func (gd *GitDir) Parents(target string) ([]string, error) {
+	lines, err := gd.RevList("--parents", "-n", "1", target)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 {
+		return nil, errors.Errorf("commit not found: %s", target)
+	}
+	return strings.Fields(lines[0])[1:], nil
+}
+
 func (gd *GitDir) Diff(target string) (string, error) {
-	stdout, _, err := gd.RunGitCommand("diff", target)
+	stdout, _, err := gd.RunGitCommand("diff", "--binary", target)
 	if err != nil {
 		return "", err
 	}
 	return stdout, nil
 }
 
+func (gd *GitDir) DiffCached(target string) (string, error) {
+	stdout, _, err := gd.RunGitCommand("diff", "--cached", "--binary", target)
+	if err != nil {
+		return "", err
+	}
+	return stdout, nil
+}
+
+func (gd *GitDir) DiffWithUntracked(target string) (string, error) {
+	tmpDirPath, err := ioutil.TempDir("", "git-kustomize-diff-index-")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+
+	// Stage everything into a temporary index not to touch the user's index.
+	indexGitDir := &GitDir{
+		GitPath: gd.GitPath,
+		WorkDir: WorkDir{
+			Dir: gd.WorkDir.Dir,
+			Env: map[string]string{},
+		},
+	}
+	for key, val := range gd.WorkDir.Env {
+		indexGitDir.WorkDir.Env[key] = val
+	}
+	// Set last not to be replaced by GIT_INDEX_FILE of the env.
+	indexGitDir.WorkDir.Env["GIT_INDEX_FILE"] = filepath.Join(tmpDirPath, "index")
+	_, _, err = indexGitDir.RunGitCommand("read-tree", target)
+	if err != nil {
+		return "", err
+	}
+	_, _, err = indexGitDir.RunGitCommand("add", "-A")
+	if err != nil {
+		return "", err
+	}
+	return indexGitDir.DiffCached(target)
+}
+
+func (gd *GitDir) RemoteHead(remote string) (string, error) {
+	stdout, _, err := gd.RunGitCommand("symbolic-ref", "-q", "--short", fmt.Sprintf("refs/remotes/%s/HEAD", remote))
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(stdout, "\n"), nil
+}
+
+func (gd *GitDir) RemoteURL(remote string) (string, error) {
+	stdout, _, err := gd.RunGitCommand("config", "--get", fmt.Sprintf("remote.%s.url", remote))
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(stdout, "\n"), nil
+}
+
 func (gd *GitDir) CurrentBranch() (string, error) {
 	stdout, _, err := gd.RunGitCommand("branch", "--show-current")
 	if err != nil {
@@ -73,6 +213,30 @@ func (gd *GitDir) CurrentBranch() (string, error) {
 }
 
 func (gd *GitDir) Clone(dstDirPath string) (*GitDir, error) {
+	insideWorkTree, err := gd.IsInsideWorkTree()
+	if err != nil {
+		return nil, err
+	}
+	if !insideWorkTree {
+		// Bare repos and git dirs are cloned as a whole.
+		gitDirPath, err := gd.AbsoluteGitDir()
+		if err != nil {
+			return nil, err
+		}
+		_, _, err = gd.RunGitCommand("clone", gitDirPath, dstDirPath)
+		if err != nil {
+			return nil, err
+		}
+		modulesDirPath, err := gd.ModulesDirPath()
+		if err != nil {
+			return nil, err
+		}
+		return &GitDir{
+			GitPath:    gd.GitPath,
+			WorkDir:    WorkDir{Dir: dstDirPath},
+			ModulesDir: modulesDirPath,
+		}, nil
+	}
 	rootDir, err := gd.GetRootDir()
 	if err != nil {
 		return nil, err
@@ -89,12 +253,33 @@ func (gd *GitDir) Clone(dstDirPath string) (*GitDir, error) {
 	if err != nil {
 		return nil, err
 	}
+	modulesDirPath, err := gd.ModulesDirPath()
+	if err != nil {
+		return nil, err
+	}
 	return &GitDir{
-		GitPath: gd.GitPath,
-		WorkDir: WorkDir{Dir: filepath.Join(dstDirPath, relPath)},
+		GitPath:    gd.GitPath,
+		WorkDir:    WorkDir{Dir: filepath.Join(dstDirPath, relPath)},
+		ModulesDir: modulesDirPath,
 	}, nil
 }
 
+func (gd *GitDir) IsInsideWorkTree() (bool, error) {
+	stdout, _, err := gd.RunGitCommand("rev-parse", "--is-inside-work-tree")
+	if err != nil {
+		return false, err
+	}
+	return strings.Trim(stdout, "\n") == "true", nil
+}
+
+func (gd *GitDir) AbsoluteGitDir() (string, error) {
+	stdout, _, err := gd.RunGitCommand("rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(stdout, "\n"), nil
+}
+
 func (gd *GitDir) GetRootDir() (string, error) {
 	// `git rev-parse --show-toplevel` returns a real path.
 	baseDirPath, _, err := gd.RunGitCommand("rev-parse", "--show-toplevel")
@@ -104,57 +289,128 @@ func (gd *GitDir) GetRootDir() (string, error) {
 	return strings.Trim(baseDirPath, "\n"), nil
 }
 
-func (gd *GitDir) CopyConfig(targetGitDir *GitDir) error {
-	baseDirPath, err := gd.GetRootDir()
+func (gd *GitDir) ModulesDirPath() (string, error) {
+	return gd.gitPath("modules")
+}
+
+func (gd *GitDir) gitPath(name string) (string, error) {
+	stdout, _, err := gd.RunGitCommand("rev-parse", "--git-path", name)
 	if err != nil {
-		return err
+		return "", err
 	}
-	targetDirPath, err := targetGitDir.GetRootDir()
-	if err != nil {
-		return err
+	path := strings.Trim(stdout, "\n")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(gd.WorkDir.Dir, path)
 	}
-	if baseDirPath == targetDirPath {
-		return nil
+	if !Exists(path) {
+		return filepath.Clean(path), nil
 	}
-	src, err := os.Open(filepath.Join(baseDirPath, ".git", "config"))
-	if err != nil {
-		return errors.WithStack(err)
+	return realpath.Realpath(path)
+}
+
+// Fetch fetches the remote, or all the remotes if it's empty.
+func (gd *GitDir) Fetch(remote string) error {
+	args := []string{"fetch", "--all"}
+	if remote != "" {
+		args = []string{"fetch", remote}
 	}
-	defer src.Close()
-	dst, err := os.Create(filepath.Join(targetDirPath, ".git", "config"))
+	_, _, err := gd.RunGitCommand(args...)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
-	defer dst.Close()
+	return nil
+}
 
-	// Manual copy as io.Copy copy_file_range has some problem in some situation.
-	st, err := src.Stat()
+func (gd *GitDir) Checkout(target string) error {
+	_, _, err := gd.RunGitCommand("checkout", target)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
-	bs := make([]byte, st.Size())
-	_, err = src.Read(bs)
+	if gd.ModulesDir != "" {
+		return gd.UpdateSubmodules(gd.ModulesDir)
+	}
+	return nil
+}
+
+// UpdateSubmodules checks out the recorded commits of the submodules by
+// cloning them from the given modules dir instead of their remote urls.
+// Submodules which don't exist in the modules dir are left uninitialized.
+func (gd *GitDir) UpdateSubmodules(modulesDirPath string) error {
+	rootDir, err := gd.GetRootDir()
 	if err != nil {
-		return errors.WithStack(err)
+		return err
 	}
-	_, err = dst.Write(bs)
+	if !Exists(filepath.Join(rootDir, ".gitmodules")) {
+		return nil
+	}
+	rootGitDir := &GitDir{GitPath: gd.GitPath, WorkDir: WorkDir{Dir: rootDir, Env: gd.WorkDir.Env}}
+	stdout, _, err := rootGitDir.RunGitCommand("config", "-f", ".gitmodules", "-z", "--get-regexp", `^submodule\..*\.path$`)
 	if err != nil {
-		return errors.WithStack(err)
+		if code := GetExitCode(err); code != nil && *code == 1 {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range strings.Split(stdout, "\x00") {
+		kv := strings.SplitN(entry, "\n", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(kv[0], "submodule."), ".path")
+		path := kv[1]
+		moduleDirPath := filepath.Join(modulesDirPath, name)
+		if !Exists(moduleDirPath) {
+			continue
+		}
+		_, _, err = rootGitDir.RunGitCommand("config", fmt.Sprintf("submodule.%s.url", name), moduleDirPath)
+		if err != nil {
+			return err
+		}
+		_, _, err = rootGitDir.RunGitCommand("-c", "protocol.file.allow=always", "submodule", "update", "--init", "--", path)
+		if err != nil {
+			return err
+		}
+		subGitDir := NewGitDir(filepath.Join(rootDir, path), gd.GitPath)
+		err = subGitDir.UpdateSubmodules(filepath.Join(moduleDirPath, "modules"))
+		if err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
-func (gd *GitDir) Fetch() error {
-	_, _, err := gd.RunGitCommand("fetch", "--all")
+// SubmoduleChanges lists the submodules whose recorded commits differ
+// between the trees.
+func (gd *GitDir) SubmoduleChanges(tree1, tree2 string) ([]*SubmoduleChange, error) {
+	stdout, _, err := gd.RunGitCommand("diff-tree", "-r", "-z", "--no-renames", tree1, tree2)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	changes := make([]*SubmoduleChange, 0)
+	fields := strings.Split(stdout, "\x00")
+	// :<old mode> SP <new mode> SP <old sha> SP <new sha> SP <status> NUL <path> NUL
+	for i := 0; i+1 < len(fields); i += 2 {
+		meta := strings.Fields(strings.TrimPrefix(fields[i], ":"))
+		if len(meta) != 5 {
+			continue
+		}
+		if meta[0] != gitFsModeSubmodule && meta[1] != gitFsModeSubmodule {
+			continue
+		}
+		change := &SubmoduleChange{Path: fields[i+1]}
+		if meta[0] == gitFsModeSubmodule {
+			change.OldCommit = meta[2]
+		}
+		if meta[1] == gitFsModeSubmodule {
+			change.NewCommit = meta[3]
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
 }
 
-func (gd *GitDir) Checkout(target string) error {
-	_, _, err := gd.RunGitCommand("checkout", target)
+func (gd *GitDir) Clean() error {
+	_, _, err := gd.RunGitCommand("clean", "-fdx", "--", ":/")
 	if err != nil {
 		return err
 	}
@@ -164,11 +420,162 @@ func (gd *GitDir) Checkout(target string) error {
 func (gd *GitDir) Merge(target string) error {
 	_, _, err := gd.RunGitCommand("merge", "--no-ff", target)
 	if err != nil {
+		files, conflictErr := gd.ConflictFiles()
+		if conflictErr == nil && len(files) > 0 {
+			return errors.WithStack(&MergeConflictError{
+				Commit: target,
+				Files:  files,
+			})
+		}
 		return err
 	}
+	if gd.ModulesDir != "" {
+		return gd.UpdateSubmodules(gd.ModulesDir)
+	}
 	return nil
 }
 
+func (gd *GitDir) ConflictFiles() ([]string, error) {
+	stdout, _, err := gd.RunGitCommand("diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, line := range strings.Split(stdout, "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// MergeBase returns an empty string if the commits have no common ancestor.
+func (gd *GitDir) MergeBase(commit1, commit2 string) (string, error) {
+	stdout, _, err := gd.RunGitCommand("merge-base", commit1, commit2)
+	if err != nil {
+		// git merge-base exits with 1 without a common ancestor.
+		if code := GetExitCode(err); code != nil && *code == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.Trim(stdout, "\n"), nil
+}
+
+var gitVersionRegexp = regexp.MustCompile(`^git version (\d+)\.(\d+)`)
+
+// parseGitVersion parses the output of `git version` into the major and minor
+// versions.
+func parseGitVersion(s string) (int, int, error) {
+	m := gitVersionRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, 0, errors.Errorf("unknown git version: %q", s)
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major, minor, nil
+}
+
+// MergeTreeSupported returns true if git is 2.38 or later, which supports
+// `merge-tree --write-tree`.
+func (gd *GitDir) MergeTreeSupported() (bool, error) {
+	stdout, _, err := gd.RunGitCommand("version")
+	if err != nil {
+		return false, err
+	}
+	major, minor, err := parseGitVersion(stdout)
+	if err != nil {
+		return false, err
+	}
+	return major > 2 || major == 2 && minor >= 38, nil
+}
+
+// MergeTree merges the commits without touching the work tree and returns
+// the hash of the resulting tree. It needs git 2.38 or later.
+func (gd *GitDir) MergeTree(commit1, commit2 string) (string, error) {
+	supported, err := gd.MergeTreeSupported()
+	if err != nil {
+		return "", err
+	}
+	if !supported {
+		return "", errors.New("merging without checkout needs git 2.38 or later")
+	}
+	stdout, _, err := gd.RunGitCommand("merge-tree", "--write-tree", "--name-only", "--no-messages", commit1, commit2)
+	lines := strings.Split(strings.Trim(stdout, "\n"), "\n")
+	if err != nil {
+		if code := GetExitCode(err); code != nil && *code == 1 && len(lines) > 1 {
+			// The file names are relative to the work dir unlike `git diff`.
+			prefix, prefixErr := gd.Prefix()
+			if prefixErr != nil {
+				return "", prefixErr
+			}
+			files := make([]string, 0, len(lines)-1)
+			for _, line := range lines[1:] {
+				files = append(files, filepath.ToSlash(filepath.Clean(prefix+line)))
+			}
+			return "", errors.WithStack(&MergeConflictError{
+				Commit: commit2,
+				Files:  files,
+			})
+		}
+		return "", err
+	}
+	return lines[0], nil
+}
+
+// ApplyToTree applies the patch to the tree in a temporary index and
+// returns the hash of the resulting tree.
+func (gd *GitDir) ApplyToTree(tree, patch string) (string, error) {
+	tmpDirPath, err := ioutil.TempDir("", "git-kustomize-diff-index-")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDirPath)
+	patchPath := filepath.Join(tmpDirPath, "patch")
+	err = ioutil.WriteFile(patchPath, []byte(patch), 0600)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	rootDir, err := gd.GetRootDir()
+	if err != nil {
+		return "", err
+	}
+	indexGitDir := &GitDir{
+		GitPath: gd.GitPath,
+		WorkDir: WorkDir{
+			Dir: rootDir,
+			Env: map[string]string{},
+		},
+	}
+	for key, val := range gd.WorkDir.Env {
+		indexGitDir.WorkDir.Env[key] = val
+	}
+	// Set last not to be replaced by GIT_INDEX_FILE of the env.
+	indexGitDir.WorkDir.Env["GIT_INDEX_FILE"] = filepath.Join(tmpDirPath, "index")
+	_, _, err = indexGitDir.RunGitCommand("read-tree", tree)
+	if err != nil {
+		return "", err
+	}
+	_, _, err = indexGitDir.RunGitCommand("apply", "--cached", patchPath)
+	if err != nil {
+		return "", err
+	}
+	stdout, _, err := indexGitDir.RunGitCommand("write-tree")
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(stdout, "\n"), nil
+}
+
+// Prefix returns the path of the work dir relative to the root dir.
+func (gd *GitDir) Prefix() (string, error) {
+	stdout, _, err := gd.RunGitCommand("rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(stdout, "\n"), nil
+}
+
 func (gd *GitDir) Apply(patch string) error {
 	tmpFile, err := ioutil.TempFile("", "git-kustomize-diff-apply-")
 	if err != nil {
@@ -203,26 +610,60 @@ func (gd *GitDir) SetUser() error {
 	return nil
 }
 
+// CloneAndCheckout clones the repo locally without accessing the remotes.
+// The clone shares all the objects of the repo, so any commit in the repo
+// can be checked out.
 func (gd *GitDir) CloneAndCheckout(dirPath, commit string) (*GitDir, error) {
 	gitDir, err := gd.Clone(dirPath)
 	if err != nil {
 		return nil, err
 	}
-	err = gd.CopyConfig(gitDir)
-	if err != nil {
-		return nil, err
-	}
 	err = gitDir.SetUser()
 	if err != nil {
 		return nil, err
 	}
-	err = gitDir.Fetch()
-	if err != nil {
-		return nil, err
-	}
 	err = gitDir.Checkout(commit)
 	if err != nil {
 		return nil, err
 	}
 	return gitDir, nil
 }
+
+// GitBlobHashFile computes the same hash as `git hash-object --no-filters`.
+func GitBlobHashFile(path string) (string, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return gitBlobHash(bs), nil
+}
+
+func gitBlobHash(bs []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(bs))
+	h.Write(bs)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+var scpLikeURLRegexp = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// RepoWebURL converts a remote URL such as git@github.com:owner/repo.git
+// into the web URL of the repo. It returns an empty string for local paths.
+func RepoWebURL(remoteURL string) string {
+	remoteURL = strings.TrimSuffix(strings.TrimSuffix(remoteURL, "/"), ".git")
+	if strings.Contains(remoteURL, "://") {
+		u, err := url.Parse(remoteURL)
+		if err != nil || u.Host == "" {
+			return ""
+		}
+		switch u.Scheme {
+		case "http", "https", "ssh", "git":
+			return fmt.Sprintf("https://%s/%s", u.Hostname(), strings.TrimPrefix(u.Path, "/"))
+		}
+		return ""
+	}
+	if m := scpLikeURLRegexp.FindStringSubmatch(remoteURL); m != nil {
+		return fmt.Sprintf("https://%s/%s", m[1], strings.TrimPrefix(m[2], "/"))
+	}
+	return ""
+}
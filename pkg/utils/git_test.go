@@ -0,0 +1,103 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitBlobHashFile(t *testing.T) {
+	wd, _ := os.Getwd()
+	path := filepath.Join(wd, "fixtures", "kustomize", "a", "pod.yaml")
+
+	expectedHash, _, err := (&WorkDir{}).RunCommand("git", "hash-object", "--no-filters", path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	hash, err := GitBlobHashFile(path)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, strings.TrimSpace(expectedHash), hash)
+}
+
+func TestParseGitVersion(t *testing.T) {
+	for s, expected := range map[string][2]int{
+		"git version 2.39.5\n":                   {2, 39},
+		"git version 2.37.1 (Apple Git-137.1)\n": {2, 37},
+		"git version 2.38.0.windows.1\n":         {2, 38},
+	} {
+		major, minor, err := parseGitVersion(s)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		assert.Equal(t, expected, [2]int{major, minor}, s)
+	}
+	_, _, err := parseGitVersion("unknown")
+	assert.Error(t, err)
+}
+
+func TestApplyToTreeWithIndexEnv(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "git-kustomize-diff-test-")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dirPath)
+	gd := NewGitDir(dirPath, "")
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		_, _, err = gd.RunGitCommand(args...)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+
+	// The temporary index is used even if GIT_INDEX_FILE is given.
+	indexPath := filepath.Join(dirPath, "index")
+	gd.WorkDir.Env = map[string]string{"GIT_INDEX_FILE": indexPath}
+	tree, err := gd.ApplyToTree("HEAD", "diff --git a/a b/a\nnew file mode 100644\n--- /dev/null\n+++ b/a\n@@ -0,0 +1 @@\n+a\n")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	stdout, _, err := gd.RunGitCommand("ls-tree", "--name-only", tree)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "a\n", stdout)
+	assert.NoFileExists(t, indexPath)
+}
+
+func TestRepoWebURL(t *testing.T) {
+	for remoteURL, expected := range map[string]string{
+		"https://github.com/owner/repo.git":         "https://github.com/owner/repo",
+		"https://user@gitlab.com/group/sub/repo":    "https://gitlab.com/group/sub/repo",
+		"git@github.com:owner/repo.git":             "https://github.com/owner/repo",
+		"ssh://git@bitbucket.org:22/owner/repo.git": "https://bitbucket.org/owner/repo",
+		"/tmp/repo":        "",
+		"file:///tmp/repo": "",
+	} {
+		assert.Equal(t, expected, RepoWebURL(remoteURL), remoteURL)
+	}
+}
@@ -0,0 +1,500 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	gitFsModeSymlink   = "120000"
+	gitFsModeSubmodule = "160000"
+	gitFsMaxSymlinks   = 16
+)
+
+type gitFsEntry struct {
+	mode string
+	hash string
+}
+
+// GitFs is a read-only filesys.FileSystem backed by a git tree object. The
+// tree is mounted at the root directory and blobs are read through
+// `git cat-file --batch` on demand.
+type GitFs struct {
+	gitDir *GitDir
+	files  map[string]gitFsEntry
+	dirs   map[string][]string
+
+	mutex  sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+var _ filesys.FileSystem = &GitFs{}
+
+// TreeFs mounts the tree at the root dir. Submodules are mounted as well
+// when their commits exist in the modules dir of the repo.
+func (gd *GitDir) TreeFs(treeish string) (*GitFs, error) {
+	modulesDirPath, err := gd.ModulesDirPath()
+	if err != nil {
+		return nil, err
+	}
+	objectDirs, err := submoduleObjectDirs(modulesDirPath)
+	if err != nil {
+		return nil, err
+	}
+	fsGitDir := &GitDir{GitPath: gd.GitPath, WorkDir: WorkDir{Dir: gd.WorkDir.Dir, Env: map[string]string{}}}
+	for key, val := range gd.WorkDir.Env {
+		fsGitDir.WorkDir.Env[key] = val
+	}
+	if len(objectDirs) > 0 {
+		fsGitDir.WorkDir.Env["GIT_ALTERNATE_OBJECT_DIRECTORIES"] = strings.Join(objectDirs, string(os.PathListSeparator))
+	}
+	fs := &GitFs{
+		gitDir: fsGitDir,
+		files:  map[string]gitFsEntry{},
+		dirs:   map[string][]string{filesys.Separator: {}},
+	}
+	err = fs.addTree(treeish, filesys.Separator, true)
+	if err != nil {
+		return nil, err
+	}
+	for dir := range fs.dirs {
+		sort.Strings(fs.dirs[dir])
+	}
+	return fs, nil
+}
+
+func (fs *GitFs) addTree(treeish, dirPath string, root bool) error {
+	stdout, _, err := fs.gitDir.RunGitCommand("ls-tree", "-r", "-z", "--full-tree", treeish)
+	if err != nil {
+		if root {
+			return err
+		}
+		// The commit of the submodule is not available locally.
+		fs.addDir(dirPath, "")
+		return nil
+	}
+	for _, line := range strings.Split(stdout, "\x00") {
+		if line == "" {
+			continue
+		}
+		// <mode> SP <type> SP <object> TAB <file>
+		tabIndex := strings.Index(line, "\t")
+		if tabIndex < 0 {
+			return errors.Errorf("unexpected ls-tree output: %q", line)
+		}
+		fields := strings.Fields(line[:tabIndex])
+		if len(fields) != 3 {
+			return errors.Errorf("unexpected ls-tree output: %q", line)
+		}
+		path := filepath.Join(dirPath, filepath.FromSlash(line[tabIndex+1:]))
+		if fields[0] == gitFsModeSubmodule {
+			err := fs.addTree(fields[2], path, false)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		fs.addDir(filepath.Dir(path), filepath.Base(path))
+		fs.files[path] = gitFsEntry{mode: fields[0], hash: fields[2]}
+	}
+	return nil
+}
+
+// submoduleObjectDirs lists the object dirs of the submodules including
+// nested ones under the modules dir.
+func submoduleObjectDirs(modulesDirPath string) ([]string, error) {
+	objectDirs := make([]string, 0)
+	if !Exists(modulesDirPath) {
+		return objectDirs, nil
+	}
+	err := filepath.Walk(modulesDirPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if !Exists(filepath.Join(path, "HEAD")) || !Exists(filepath.Join(path, "objects")) {
+			return nil
+		}
+		objectDirs = append(objectDirs, filepath.Join(path, "objects"))
+		nestedObjectDirs, err := submoduleObjectDirs(filepath.Join(path, "modules"))
+		if err != nil {
+			return err
+		}
+		objectDirs = append(objectDirs, nestedObjectDirs...)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objectDirs, nil
+}
+
+func (fs *GitFs) addDir(dir, child string) {
+	children, ok := fs.dirs[dir]
+	if !ok {
+		fs.addDir(filepath.Dir(dir), filepath.Base(dir))
+	}
+	if child != "" {
+		fs.dirs[dir] = append(children, child)
+	} else if !ok {
+		fs.dirs[dir] = []string{}
+	}
+}
+
+func (fs *GitFs) Close() error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.cmd == nil {
+		return nil
+	}
+	fs.stdin.Close()
+	err := fs.cmd.Wait()
+	fs.cmd = nil
+	return errors.WithStack(err)
+}
+
+func (fs *GitFs) clean(path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filesys.Separator, path)
+	}
+	return filepath.Clean(path)
+}
+
+// resolve follows symlinks to files in the tree.
+func (fs *GitFs) resolve(path string) (string, *gitFsEntry, error) {
+	path = fs.clean(path)
+	for i := 0; i < gitFsMaxSymlinks; i++ {
+		entry, ok := fs.files[path]
+		if !ok {
+			return path, nil, nil
+		}
+		if entry.mode != gitFsModeSymlink {
+			return path, &entry, nil
+		}
+		target, err := fs.readBlob(entry.hash)
+		if err != nil {
+			return "", nil, err
+		}
+		targetPath := string(target)
+		if !filepath.IsAbs(targetPath) {
+			targetPath = filepath.Join(filepath.Dir(path), targetPath)
+		}
+		path = filepath.Clean(targetPath)
+	}
+	return "", nil, errors.Errorf("too many levels of symbolic links: %s", path)
+}
+
+func (fs *GitFs) readBlob(hash string) ([]byte, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if fs.cmd == nil {
+		gitPath := fs.gitDir.GitPath
+		if gitPath == "" {
+			gitPath = "git"
+		}
+		cmd := exec.Command(gitPath, "cat-file", "--batch")
+		cmd.Dir = fs.gitDir.WorkDir.Dir
+		cmd.Env = fs.gitDir.WorkDir.environ()
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		err = cmd.Start()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		fs.cmd = cmd
+		fs.stdin = stdin
+		fs.stdout = bufio.NewReader(stdout)
+	}
+	_, err := fmt.Fprintf(fs.stdin, "%s\n", hash)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	header, err := fs.stdout.ReadString('\n')
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// <oid> SP <type> SP <size> LF
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return nil, errors.Errorf("failed to read the object %s: %s", hash, strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	bs := make([]byte, size+1)
+	_, err = io.ReadFull(fs.stdout, bs)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return bs[:size], nil
+}
+
+func (fs *GitFs) notExist(path string) error {
+	return errors.WithStack(&os.PathError{Op: "open", Path: path, Err: os.ErrNotExist})
+}
+
+func (fs *GitFs) readOnly(path string) error {
+	return errors.WithStack(&os.PathError{Op: "write", Path: path, Err: os.ErrPermission})
+}
+
+// BlobHash returns the blob hash of the file without reading the content.
+func (fs *GitFs) BlobHash(path string) (string, error) {
+	resolvedPath, entry, err := fs.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", fs.notExist(resolvedPath)
+	}
+	return entry.hash, nil
+}
+
+func (fs *GitFs) Create(path string) (filesys.File, error) {
+	return nil, fs.readOnly(path)
+}
+
+func (fs *GitFs) Mkdir(path string) error {
+	return fs.readOnly(path)
+}
+
+func (fs *GitFs) MkdirAll(path string) error {
+	return fs.readOnly(path)
+}
+
+func (fs *GitFs) RemoveAll(path string) error {
+	return fs.readOnly(path)
+}
+
+func (fs *GitFs) WriteFile(path string, data []byte) error {
+	return fs.readOnly(path)
+}
+
+func (fs *GitFs) Open(path string) (filesys.File, error) {
+	resolvedPath, entry, err := fs.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		if fs.IsDir(resolvedPath) {
+			return &gitFsFile{info: gitFsFileInfo{name: filepath.Base(resolvedPath), dir: true}}, nil
+		}
+		return nil, fs.notExist(path)
+	}
+	bs, err := fs.readBlob(entry.hash)
+	if err != nil {
+		return nil, err
+	}
+	return &gitFsFile{
+		Reader: bytes.NewReader(bs),
+		info:   gitFsFileInfo{name: filepath.Base(path), size: int64(len(bs))},
+	}, nil
+}
+
+func (fs *GitFs) ReadFile(path string) ([]byte, error) {
+	resolvedPath, entry, err := fs.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fs.notExist(resolvedPath)
+	}
+	return fs.readBlob(entry.hash)
+}
+
+func (fs *GitFs) IsDir(path string) bool {
+	_, ok := fs.dirs[fs.clean(path)]
+	return ok
+}
+
+func (fs *GitFs) ReadDir(path string) ([]string, error) {
+	children, ok := fs.dirs[fs.clean(path)]
+	if !ok {
+		return nil, fs.notExist(path)
+	}
+	return append([]string{}, children...), nil
+}
+
+func (fs *GitFs) CleanedAbs(path string) (filesys.ConfirmedDir, string, error) {
+	cleanedPath := fs.clean(path)
+	if fs.IsDir(cleanedPath) {
+		return filesys.ConfirmedDir(cleanedPath), "", nil
+	}
+	if _, ok := fs.files[cleanedPath]; ok {
+		return filesys.ConfirmedDir(filepath.Dir(cleanedPath)), filepath.Base(cleanedPath), nil
+	}
+	return "", "", errors.Wrap(fs.notExist(path), "unable to clean")
+}
+
+func (fs *GitFs) Exists(path string) bool {
+	cleanedPath := fs.clean(path)
+	if fs.IsDir(cleanedPath) {
+		return true
+	}
+	_, entry, err := fs.resolve(cleanedPath)
+	return err == nil && entry != nil
+}
+
+func (fs *GitFs) Glob(pattern string) ([]string, error) {
+	pattern = fs.clean(pattern)
+	matches := make([]string, 0)
+	for _, paths := range []map[string]struct{}{fs.filePaths(), fs.dirPaths()} {
+		for path := range paths {
+			m, err := filepath.Match(pattern, path)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if m {
+				matches = append(matches, path)
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (fs *GitFs) filePaths() map[string]struct{} {
+	paths := make(map[string]struct{}, len(fs.files))
+	for path := range fs.files {
+		paths[path] = struct{}{}
+	}
+	return paths
+}
+
+func (fs *GitFs) dirPaths() map[string]struct{} {
+	paths := make(map[string]struct{}, len(fs.dirs))
+	for path := range fs.dirs {
+		paths[path] = struct{}{}
+	}
+	return paths
+}
+
+func (fs *GitFs) Walk(path string, walkFn filepath.WalkFunc) error {
+	cleanedPath := fs.clean(path)
+	if !fs.Exists(cleanedPath) {
+		return walkFn(path, nil, fs.notExist(path))
+	}
+	err := fs.walk(path, cleanedPath, walkFn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (fs *GitFs) walk(path, cleanedPath string, walkFn filepath.WalkFunc) error {
+	children, isDir := fs.dirs[cleanedPath]
+	info := gitFsFileInfo{name: filepath.Base(cleanedPath), dir: isDir}
+	err := walkFn(path, info, nil)
+	if err != nil || !isDir {
+		return err
+	}
+	for _, child := range children {
+		err := fs.walk(filepath.Join(path, child), filepath.Join(cleanedPath, child), walkFn)
+		if err != nil {
+			if err == filepath.SkipDir {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+type gitFsFile struct {
+	*bytes.Reader
+	info gitFsFileInfo
+}
+
+func (f *gitFsFile) Read(p []byte) (int, error) {
+	if f.Reader == nil {
+		return 0, io.EOF
+	}
+	return f.Reader.Read(p)
+}
+
+func (f *gitFsFile) Write(p []byte) (int, error) {
+	return 0, errors.WithStack(&os.PathError{Op: "write", Path: f.info.name, Err: os.ErrPermission})
+}
+
+func (f *gitFsFile) Close() error {
+	return nil
+}
+
+func (f *gitFsFile) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+type gitFsFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi gitFsFileInfo) Name() string { return fi.name }
+
+func (fi gitFsFileInfo) Size() int64 { return fi.size }
+
+func (fi gitFsFileInfo) Mode() os.FileMode {
+	if fi.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi gitFsFileInfo) ModTime() time.Time { return time.Time{} }
+
+func (fi gitFsFileInfo) IsDir() bool { return fi.dir }
+
+func (fi gitFsFileInfo) Sys() interface{} { return nil }
+
+// BlobHash computes the same hash as `git hash-object --no-filters` for a
+// file, or uses the known hash when the file system is backed by git.
+func BlobHash(fSys filesys.FileSystem, path string) (string, error) {
+	if gitFs, ok := fSys.(*GitFs); ok {
+		return gitFs.BlobHash(path)
+	}
+	bs, err := fSys.ReadFile(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return gitBlobHash(bs), nil
+}
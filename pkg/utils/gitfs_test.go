@@ -0,0 +1,127 @@
+/*
+Copyright 2021 Daisuke Taniwaki.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitFs(t *testing.T) {
+	tmpDirPath, err := ioutil.TempDir("", "git-kustomize-diff-gitfs-")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.RemoveAll(tmpDirPath)
+	for path, content := range map[string]string{
+		"a/kustomization.yaml": "resources:\n- pod.yaml\n",
+		"a/pod.yaml":           "kind: Pod\n",
+		"b/c/d.txt":            "d\n",
+	} {
+		fullPath := filepath.Join(tmpDirPath, path)
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(fullPath), 0700)) {
+			t.FailNow()
+		}
+		if !assert.NoError(t, ioutil.WriteFile(fullPath, []byte(content), 0600)) {
+			t.FailNow()
+		}
+	}
+	if !assert.NoError(t, os.Symlink("../a/pod.yaml", filepath.Join(tmpDirPath, "b", "link.yaml"))) {
+		t.FailNow()
+	}
+	gitDir := NewGitDir(tmpDirPath, "")
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		_, _, err := gitDir.RunGitCommand(args...)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+
+	fs, err := gitDir.TreeFs("HEAD")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer fs.Close()
+
+	bs, err := fs.ReadFile("/a/pod.yaml")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "kind: Pod\n", string(bs))
+	bs, err = fs.ReadFile("/b/link.yaml")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "kind: Pod\n", string(bs))
+	_, err = fs.ReadFile("/a/missing.yaml")
+	assert.True(t, os.IsNotExist(errors.Cause(err)))
+
+	assert.True(t, fs.Exists("/b/c"))
+	assert.True(t, fs.IsDir("/b/c"))
+	assert.False(t, fs.IsDir("/b/c/d.txt"))
+	assert.False(t, fs.Exists("/b/e"))
+
+	children, err := fs.ReadDir("/")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"a", "b"}, children)
+
+	dir, file, err := fs.CleanedAbs("/a/../a/pod.yaml")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "/a", dir.String())
+	assert.Equal(t, "pod.yaml", file)
+
+	matches, err := fs.Glob("/a/*.yaml")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"/a/kustomization.yaml", "/a/pod.yaml"}, matches)
+
+	paths := make([]string, 0)
+	err = fs.Walk("/b", func(path string, info os.FileInfo, err error) error {
+		paths = append(paths, path)
+		return err
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{"/b", "/b/c", "/b/c/d.txt", "/b/link.yaml"}, paths)
+
+	expectedHash, err := GitBlobHashFile(filepath.Join(tmpDirPath, "a", "pod.yaml"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	hash, err := BlobHash(fs, "/a/pod.yaml")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, expectedHash, hash)
+
+	assert.Error(t, fs.WriteFile("/a/pod.yaml", []byte("")))
+}
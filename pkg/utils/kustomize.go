@@ -18,12 +18,17 @@ package utils
 
 import (
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/pkg/errors"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/kustomize/kyaml/kio"
 )
 
 type ListKustomizeDirsOpts struct {
@@ -32,15 +37,19 @@ type ListKustomizeDirsOpts struct {
 }
 
 func ListKustomizeDirs(dirPath string, opts ListKustomizeDirsOpts) ([]string, error) {
+	return ListKustomizeDirsInFs(filesys.MakeFsOnDisk(), dirPath, opts)
+}
+
+func ListKustomizeDirsInFs(fSys filesys.FileSystem, dirPath string, opts ListKustomizeDirsOpts) ([]string, error) {
 	targetFiles := make([]string, 0)
-	err := filepath.WalkDir(dirPath, func(path string, d fs.DirEntry, err error) error {
+	err := fSys.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		if !d.IsDir() {
+		if !info.IsDir() {
 			return nil
 		}
-		if !KustomizationExists(path) {
+		if !KustomizationExistsInFs(fSys, path) {
 			return nil
 		}
 		included := true
@@ -74,22 +83,303 @@ func ListKustomizeDirs(dirPath string, opts ListKustomizeDirsOpts) ([]string, er
 }
 
 func KustomizationExists(path string) bool {
-	return Exists(filepath.Join(path, "kustomization.yaml")) || Exists(filepath.Join(path, "kustomization.yml"))
+	return KustomizationExistsInFs(filesys.MakeFsOnDisk(), path)
+}
+
+func KustomizationExistsInFs(fSys filesys.FileSystem, path string) bool {
+	return fSys.Exists(filepath.Join(path, "kustomization.yaml")) || fSys.Exists(filepath.Join(path, "kustomization.yml"))
+}
+
+// remoteTargetRegexp matches the remote targets of kustomize such as URLs,
+// `git@host:org/repo` and `host/org/repo//path?ref=`.
+var remoteTargetRegexp = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*::)?([a-zA-Z][a-zA-Z0-9+.-]*://|git@|[a-zA-Z0-9-]+(\.[a-zA-Z0-9-]+)+/[^/]+/[^/])`)
+
+func isRemoteTarget(path string) bool {
+	return remoteTargetRegexp.MatchString(path)
 }
 
-func MakeKustomizeDir(dirPath string) error {
-	err := os.MkdirAll(dirPath, 0700)
+type KustomizationInputs struct {
+	// Files are the local files the build reads, sorted and deduplicated.
+	Files []string
+	// Remote are the inputs which are not on the local file system such as
+	// remote bases and helm charts.
+	Remote []string
+}
+
+func ListKustomizationInputs(fSys filesys.FileSystem, dirPath string) (*KustomizationInputs, error) {
+	files := map[string]struct{}{}
+	remote := map[string]struct{}{}
+	err := collectKustomizationInputs(fSys, dirPath, files, remote, map[string]struct{}{})
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, err
+	}
+	inputs := &KustomizationInputs{
+		Files:  make([]string, 0, len(files)),
+		Remote: make([]string, 0, len(remote)),
 	}
-	kustomizationFilePath := filepath.Join(dirPath, "kustomization.yaml")
-	if Exists(kustomizationFilePath) {
-		return fmt.Errorf("File already exists: %s", kustomizationFilePath)
+	for file := range files {
+		inputs.Files = append(inputs.Files, file)
 	}
-	f, err := os.Create(kustomizationFilePath)
+	for r := range remote {
+		inputs.Remote = append(inputs.Remote, r)
+	}
+	sort.Strings(inputs.Files)
+	sort.Strings(inputs.Remote)
+	return inputs, nil
+}
+
+func collectKustomizationInputs(fSys filesys.FileSystem, dirPath string, files, remote, visited map[string]struct{}) error {
+	dirPath = filepath.Clean(dirPath)
+	if _, ok := visited[dirPath]; ok {
+		return nil
+	}
+	visited[dirPath] = struct{}{}
+
+	kustomizationPath, k, err := readKustomization(fSys, dirPath)
 	if err != nil {
-		return errors.WithStack(err)
+		return err
+	}
+	files[kustomizationPath] = struct{}{}
+
+	addFile := func(path string) {
+		if path == "" {
+			return
+		}
+		fullPath := filepath.Join(dirPath, path)
+		if fSys.Exists(fullPath) && !fSys.IsDir(fullPath) {
+			files[fullPath] = struct{}{}
+		}
+	}
+	addFileOrDir := func(path string) error {
+		if path == "" {
+			return nil
+		}
+		fullPath := filepath.Join(dirPath, path)
+		if !fSys.Exists(fullPath) {
+			// kustomize falls back to a remote target when the path doesn't exist locally.
+			if isRemoteTarget(path) {
+				remote[path] = struct{}{}
+				return nil
+			}
+			return errors.Errorf("%s not found in %s", path, dirPath)
+		}
+		if fSys.IsDir(fullPath) {
+			return collectKustomizationInputs(fSys, fullPath, files, remote, visited)
+		}
+		files[fullPath] = struct{}{}
+		return nil
+	}
+	addInlineOrFileOrDir := func(path string) error {
+		if strings.Contains(path, "\n") {
+			// inline configuration
+			return nil
+		}
+		return addFileOrDir(path)
+	}
+
+	for _, path := range append(append([]string{}, k.Resources...), k.Components...) {
+		err := addFileOrDir(path)
+		if err != nil {
+			return err
+		}
+	}
+	for _, paths := range [][]string{k.Generators, k.Transformers, k.Validators} {
+		for _, path := range paths {
+			err := addInlineOrFileOrDir(path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, path := range append(append([]string{}, k.Crds...), k.Configurations...) {
+		addFile(path)
+	}
+	for _, patch := range k.PatchesStrategicMerge {
+		addFile(string(patch))
+	}
+	for _, patch := range append(append([]types.Patch{}, k.Patches...), k.PatchesJson6902...) {
+		addFile(patch.Path)
+	}
+	for _, replacement := range k.Replacements {
+		addFile(replacement.Path)
+	}
+	addFile(k.OpenAPI["path"])
+	kvSources := make([]types.KvPairSources, 0, len(k.ConfigMapGenerator)+len(k.SecretGenerator))
+	for _, generator := range k.ConfigMapGenerator {
+		kvSources = append(kvSources, generator.KvPairSources)
+	}
+	for _, generator := range k.SecretGenerator {
+		kvSources = append(kvSources, generator.KvPairSources)
+	}
+	for _, kvSource := range kvSources {
+		for _, source := range kvSource.FileSources {
+			// The source can be in the form of `key=path`.
+			if i := strings.Index(source, "="); i >= 0 {
+				source = source[i+1:]
+			}
+			addFile(source)
+		}
+		for _, source := range kvSource.EnvSources {
+			addFile(source)
+		}
+	}
+	for _, chart := range k.HelmCharts {
+		remote[fmt.Sprintf("helm:%s/%s", chart.Repo, chart.Name)] = struct{}{}
+		addFile(chart.ValuesFile)
+	}
+	return nil
+}
+
+func KustomizationFilePath(fSys filesys.FileSystem, dirPath string) (string, error) {
+	for _, name := range konfig.RecognizedKustomizationFileNames() {
+		if fSys.Exists(filepath.Join(dirPath, name)) {
+			return filepath.Join(dirPath, name), nil
+		}
+	}
+	return "", errors.Errorf("kustomization not found in %s", dirPath)
+}
+
+func readKustomization(fSys filesys.FileSystem, dirPath string) (string, *types.Kustomization, error) {
+	kustomizationPath, err := KustomizationFilePath(fSys, dirPath)
+	if err != nil {
+		return "", nil, err
+	}
+	bs, err := fSys.ReadFile(kustomizationPath)
+	if err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+	k := &types.Kustomization{}
+	err = k.Unmarshal(bs)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to parse %s", kustomizationPath)
+	}
+	k.FixKustomizationPostUnmarshalling()
+	return kustomizationPath, k, nil
+}
+
+type KustomizationPatch struct {
+	Path string
+	// Kind and Name are the target of the patch, which are empty if any.
+	Kind string
+	Name string
+	// NamePrefix and NameSuffix are added to the name by the kustomization
+	// of the patch and the ones including it.
+	NamePrefix string
+	NameSuffix string
+}
+
+func (p *KustomizationPatch) Match(kind, name string) bool {
+	if p.Kind != "" && p.Kind != kind {
+		return false
+	}
+	return p.Name == "" || p.NamePrefix+p.Name+p.NameSuffix == name
+}
+
+// ListKustomizationPatches lists the patch files of the kustomization and its
+// local bases with their targets. Inline patches are not listed.
+func ListKustomizationPatches(fSys filesys.FileSystem, dirPath string) ([]*KustomizationPatch, error) {
+	patches := make([]*KustomizationPatch, 0)
+	err := collectKustomizationPatches(fSys, dirPath, "", "", &patches, map[string]struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(patches, func(i, j int) bool {
+		return patches[i].Path < patches[j].Path
+	})
+	return patches, nil
+}
+
+// collectKustomizationPatches collects the patches with the name prefix and
+// suffix of the kustomizations including dirPath.
+func collectKustomizationPatches(fSys filesys.FileSystem, dirPath, namePrefix, nameSuffix string, patches *[]*KustomizationPatch, visited map[string]struct{}) error {
+	dirPath = filepath.Clean(dirPath)
+	if _, ok := visited[dirPath]; ok {
+		return nil
+	}
+	visited[dirPath] = struct{}{}
+
+	_, k, err := readKustomization(fSys, dirPath)
+	if err != nil {
+		return err
+	}
+	// The patches are applied before the name prefix and suffix of the same
+	// kustomization.
+	namePrefix += k.NamePrefix
+	nameSuffix = k.NameSuffix + nameSuffix
+	for _, path := range append(append([]string{}, k.Resources...), k.Components...) {
+		fullPath := filepath.Join(dirPath, path)
+		if fSys.Exists(fullPath) && fSys.IsDir(fullPath) {
+			err := collectKustomizationPatches(fSys, fullPath, namePrefix, nameSuffix, patches, visited)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	addPatchFile := func(path string) error {
+		fullPath := filepath.Join(dirPath, path)
+		if !fSys.Exists(fullPath) || fSys.IsDir(fullPath) {
+			return nil
+		}
+		bs, err := fSys.ReadFile(fullPath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		nodes, err := kio.FromBytes(bs)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse %s", fullPath)
+		}
+		for _, node := range nodes {
+			*patches = append(*patches, &KustomizationPatch{
+				Path:       fullPath,
+				Kind:       node.GetKind(),
+				Name:       node.GetName(),
+				NamePrefix: namePrefix,
+				NameSuffix: nameSuffix,
+			})
+		}
+		return nil
+	}
+	for _, patch := range k.PatchesStrategicMerge {
+		if strings.Contains(string(patch), "\n") {
+			// inline patch
+			continue
+		}
+		err := addPatchFile(string(patch))
+		if err != nil {
+			return err
+		}
+	}
+	for _, patch := range k.Patches {
+		if patch.Path == "" {
+			continue
+		}
+		if patch.Target == nil {
+			err := addPatchFile(patch.Path)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		*patches = append(*patches, &KustomizationPatch{
+			Path:       filepath.Join(dirPath, patch.Path),
+			Kind:       patch.Target.Kind,
+			Name:       patch.Target.Name,
+			NamePrefix: namePrefix,
+			NameSuffix: nameSuffix,
+		})
+	}
+	for _, patch := range k.PatchesJson6902 {
+		if patch.Path == "" || patch.Target == nil {
+			continue
+		}
+		*patches = append(*patches, &KustomizationPatch{
+			Path:       filepath.Join(dirPath, patch.Path),
+			Kind:       patch.Target.Kind,
+			Name:       patch.Target.Name,
+			NamePrefix: namePrefix,
+			NameSuffix: nameSuffix,
+		})
 	}
-	defer f.Close()
 	return nil
 }
@@ -23,6 +23,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
 )
 
 func TestListKustomizeDirs(t *testing.T) {
@@ -55,3 +56,78 @@ func TestListKustomizeDirs(t *testing.T) {
 		"b",
 	}, dirs)
 }
+
+func TestListKustomizationInputs(t *testing.T) {
+	wd, _ := os.Getwd()
+	dirPath := filepath.Join(wd, "fixtures", "inputs")
+
+	inputs, err := ListKustomizationInputs(filesys.MakeFsOnDisk(), filepath.Join(dirPath, "overlay"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []string{
+		filepath.Join(dirPath, "base", "kustomization.yaml"),
+		filepath.Join(dirPath, "base", "pod.yaml"),
+		filepath.Join(dirPath, "component", "json-patch.yaml"),
+		filepath.Join(dirPath, "component", "kustomization.yaml"),
+		filepath.Join(dirPath, "overlay", "config.env"),
+		filepath.Join(dirPath, "overlay", "config.properties"),
+		filepath.Join(dirPath, "overlay", "kustomization.yaml"),
+		filepath.Join(dirPath, "overlay", "other.properties"),
+		filepath.Join(dirPath, "overlay", "patch.yaml"),
+	}, inputs.Files)
+	assert.Equal(t, []string{
+		"github.com/example/repo//base?ref=v1.0.0",
+	}, inputs.Remote)
+
+	_, err = ListKustomizationInputs(filesys.MakeFsOnDisk(), filepath.Join(dirPath, "none"))
+	assert.Error(t, err)
+
+	// A missing local file is not a remote input.
+	fSys := filesys.MakeFsInMemory()
+	err = fSys.WriteFile("/app/kustomization.yaml", []byte("resources:\n- missing.yaml\n"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = ListKustomizationInputs(fSys, "/app")
+	assert.EqualError(t, err, "missing.yaml not found in /app")
+}
+
+func TestIsRemoteTarget(t *testing.T) {
+	for path, expected := range map[string]bool{
+		"github.com/example/repo//base?ref=v1.0.0":     true,
+		"https://github.com/example/repo.git//base":    true,
+		"git@github.com:example/repo.git":              true,
+		"git::https://example.com/repo.git":            true,
+		"ssh://git@github.com/example/repo.git?ref=v1": true,
+		"pod.yaml":                 false,
+		"../base":                  false,
+		"config.d/pod.yaml":        false,
+		"./github.com/example/pod": false,
+	} {
+		assert.Equal(t, expected, isRemoteTarget(path), path)
+	}
+}
+
+func TestListKustomizationPatches(t *testing.T) {
+	wd, _ := os.Getwd()
+	dirPath := filepath.Join(wd, "fixtures", "inputs")
+
+	patches, err := ListKustomizationPatches(filesys.MakeFsOnDisk(), filepath.Join(dirPath, "overlay"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, []*KustomizationPatch{
+		{Path: filepath.Join(dirPath, "component", "json-patch.yaml"), Kind: "Pod", Name: "app", NamePrefix: "prefix-", NameSuffix: "-suffix"},
+		{Path: filepath.Join(dirPath, "overlay", "patch.yaml"), Kind: "Pod", Name: "app", NamePrefix: "prefix-", NameSuffix: "-suffix"},
+	}, patches)
+	assert.True(t, patches[0].Match("Pod", "prefix-app-suffix"))
+	assert.False(t, patches[0].Match("Deployment", "prefix-app-suffix"))
+	assert.False(t, patches[0].Match("Pod", "app"))
+	assert.False(t, patches[0].Match("Pod", "prefix-webapp-suffix"))
+	assert.False(t, patches[0].Match("Pod", "webapp"))
+	assert.False(t, patches[0].Match("Pod", "other"))
+
+	_, err = ListKustomizationPatches(filesys.MakeFsOnDisk(), filepath.Join(dirPath, "none"))
+	assert.Error(t, err)
+}